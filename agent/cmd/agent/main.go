@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
-	"time"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 
 	"home-telemetry/agent/internal/client"
 	"home-telemetry/agent/internal/collectors"
@@ -15,43 +19,108 @@ func main() {
 	cfg := config.Load()
 	logger := log.New(log.Writer(), "", log.LstdFlags)
 	c := client.New(cfg.ServerURL, cfg.AuthToken)
+	c.SetRetryPolicy(client.RetryPolicy{
+		MaxAttempts: cfg.RetryAttempts,
+		BaseDelay:   cfg.RetryBase,
+		MaxDelay:    cfg.RetryMax,
+	})
+	c.SetFlushInterval(cfg.Interval)
 
-	logger.Printf("agent starting: node=%s interval=%s server=%s", cfg.NodeID, cfg.Interval, cfg.ServerURL)
+	registry := collectors.NewRegistry()
+	registry.Register(collectors.NewCPU(cfg.LHMURL))
+	registry.Register(collectors.NewMem())
+	disk, err := collectors.NewDisk(cfg.DiskInclude, cfg.DiskExclude, cfg.DiskExcludeFSTypes)
+	if err != nil {
+		logger.Fatalf("disk: %v", err)
+	}
+	registry.Register(disk)
+	netc, err := collectors.NewNet(cfg.NetInclude, cfg.NetExclude)
+	if err != nil {
+		logger.Fatalf("net: %v", err)
+	}
+	registry.Register(netc)
+	registry.Register(collectors.NewNvidia())
+	lhm, err := collectors.NewLHM(cfg.LHMURL, cfg.LHMInclude, cfg.LHMExclude)
+	if err != nil {
+		logger.Fatalf("lhm: %v", err)
+	}
+	registry.Register(lhm)
+	if runtime.GOOS != "windows" {
+		// LibreHardwareMonitor only exists on Windows; --collectors can still
+		// turn it on, e.g. for a remote LHM_URL.
+		_ = registry.Disable("lhm")
+	}
+	if err := registry.Configure(cfg.Collectors, cfg.DisableCollectors); err != nil {
+		logger.Fatalf("collectors: %v", err)
+	}
+	if err := registry.ConfigureSchedules(cfg.CollectorIntervals, cfg.CollectorTimeouts); err != nil {
+		logger.Fatalf("collectors: %v", err)
+	}
+	jobs := registry.Jobs(collectors.Schedule{Interval: cfg.Interval})
 
-	collectOnce := func() {
-		cpu, cpuErr := collectors.CollectCPU(cfg.LHMURL)
-		gpus, gpuErr := collectors.CollectNvidia()
+	logger.Printf("agent starting: node=%s interval=%s server=%s", cfg.NodeID, cfg.Interval, cfg.ServerURL)
+	for _, job := range jobs {
+		logger.Printf("collector %s: interval=%s timeout=%s", job.Name(), job.Interval, job.Timeout)
+	}
 
-		if cpuErr != nil {
-			logger.Printf("cpu error: %v", cpuErr)
-		}
-		if gpuErr != nil {
-			logger.Printf("gpu error: %v", gpuErr)
+	if cfg.SpoolDir != "" && !cfg.PrintOnly {
+		spool, err := client.OpenSpool(cfg.SpoolDir, cfg.SpoolMaxBytes, cfg.SpoolMaxAge)
+		if err != nil {
+			logger.Fatalf("spool: %v", err)
 		}
+		c.UseSpool(spool)
+		logger.Printf("spool: dir=%s queued=%d", spool.Dir(), spool.Len())
+	}
 
-		payload := types.NewPayload(cfg.NodeID, cpu, gpus)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	send := func(payload types.IngestPayload) {
 		if cfg.PrintOnly {
 			b, _ := json.MarshalIndent(payload, "", "  ")
 			logger.Println(string(b))
 			return
 		}
-
-		if err := c.Send(payload); err != nil {
+		if err := c.Deliver(ctx, payload); err != nil {
 			logger.Printf("send error: %v", err)
 		}
 	}
 
+	sched := &collectors.Scheduler{
+		NewPayload: func() types.IngestPayload { return types.NewPayload(cfg.NodeID, nil, nil) },
+		Logger:     logger,
+	}
+
 	if cfg.Once {
-		collectOnce()
+		send(sched.RunOnce(ctx, jobs))
 		return
 	}
 
-	ticker := time.NewTicker(cfg.Interval)
-	defer ticker.Stop()
-
-	for {
-		collectOnce()
-		<-ticker.C
+	// A single sender keeps payloads ordered and means a slow server never
+	// blocks collection. If it still falls behind, payloads go straight to
+	// the spool; they may then reach the server slightly out of order, but
+	// keep their timestamps.
+	queue := make(chan types.IngestPayload, 256)
+	sched.Emit = func(p types.IngestPayload) {
+		select {
+		case queue <- p:
+		default:
+			if err := c.Enqueue(p); err != nil {
+				logger.Printf("send queue full, dropping payload from %s: %v", p.Timestamp, err)
+			}
+		}
 	}
-}
\ No newline at end of file
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range queue {
+			send(p)
+		}
+	}()
+
+	sched.Run(ctx, jobs)
+	close(queue)
+	<-done
+	logger.Printf("agent stopped")
+}
@@ -2,37 +2,205 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"home-telemetry/agent/internal/types"
 )
 
+const (
+	maxResponseBytes = 4 << 20
+	// BatchSize is the most spooled payloads replayed in one batch request.
+	BatchSize = 500
+)
+
 type Client struct {
-	baseURL  string
-	auth     string
-	httpc    *http.Client
+	baseURL string
+	auth    string
+	httpc   *http.Client
+	spool   *Spool
+	retry   RetryPolicy
+	noBatch bool
+
+	flushEvery time.Duration
+	nextFlush  time.Time
 }
 
 func New(baseURL, auth string) *Client {
 	return &Client{
-		baseURL: baseURL,
-		auth:    auth,
-		httpc: &http.Client{Timeout: 10 * time.Second},
+		baseURL:    baseURL,
+		auth:       auth,
+		httpc:      &http.Client{Timeout: 10 * time.Second},
+		retry:      DefaultRetryPolicy(),
+		flushEvery: 5 * time.Second,
+	}
+}
+
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.retry = p
+}
+
+// SetFlushInterval sets how often Deliver tries to replay a spool backlog.
+// In between, new payloads are only added to the spool.
+func (c *Client) SetFlushInterval(d time.Duration) {
+	c.flushEvery = d
+}
+
+// UseSpool makes Deliver queue undeliverable payloads in s and replay them
+// once the server is reachable again.
+func (c *Client) UseSpool(s *Spool) {
+	c.spool = s
+}
+
+// Deliver sends payload, falling back to the spool when one is configured.
+// While a backlog exists new payloads go to the back of the queue so the
+// server always receives them in collection order, and the backlog is
+// replayed at most once per flush interval with a single attempt per
+// request, so an unreachable server cannot hold up the caller. Payloads the
+// server rejects outright are never spooled.
+func (c *Client) Deliver(ctx context.Context, payload types.IngestPayload) error {
+	if c.spool == nil {
+		return c.Send(ctx, payload)
+	}
+
+	if c.spool.Len() == 0 {
+		err := c.Send(ctx, payload)
+		if err == nil || IsRejected(err) {
+			return err
+		}
+		c.nextFlush = time.Now().Add(c.flushEvery)
+		if spoolErr := c.spool.Push(payload); spoolErr != nil {
+			return fmt.Errorf("%w (spool: %v)", err, spoolErr)
+		}
+		return err
+	}
+
+	if err := c.spool.Push(payload); err != nil {
+		return fmt.Errorf("spool: %w", err)
+	}
+	now := time.Now()
+	if now.Before(c.nextFlush) {
+		return nil
+	}
+	c.nextFlush = now.Add(c.flushEvery)
+	return c.flush(ctx)
+}
+
+// Enqueue adds payload to the spool without trying to send it, for callers
+// that cannot wait for Deliver. A later Deliver replays it.
+func (c *Client) Enqueue(payload types.IngestPayload) error {
+	if c.spool == nil {
+		return fmt.Errorf("no spool configured")
+	}
+	return c.spool.Push(payload)
+}
+
+// flush drains the spool, using the batch endpoint while there is more than
+// one payload queued. Servers without the batch endpoint get one request per
+// payload. Requests are not retried: the payloads stay spooled for the next
+// flush.
+func (c *Client) flush(ctx context.Context) error {
+	if !c.noBatch && c.spool.Len() > 1 {
+		_, err := c.spool.ReplayBatch(BatchSize, func(batch []types.IngestPayload) (types.BatchResult, error) {
+			return c.sendBatch(ctx, batch, 1)
+		})
+		var se *SendError
+		if !errors.As(err, &se) || (se.StatusCode != http.StatusNotFound && se.StatusCode != http.StatusMethodNotAllowed) {
+			return err
+		}
+		c.noBatch = true
 	}
+	_, err := c.spool.Replay(func(p types.IngestPayload) error {
+		return c.send(ctx, p, 1)
+	})
+	return err
 }
 
-func (c *Client) Send(payload types.IngestPayload) error {
+// Send posts payload to the ingest endpoint, retrying transient failures
+// according to the client's retry policy. Failures are returned as
+// *SendError.
+func (c *Client) Send(ctx context.Context, payload types.IngestPayload) error {
+	return c.send(ctx, payload, c.retry.MaxAttempts)
+}
+
+func (c *Client) send(ctx context.Context, payload types.IngestPayload, attempts int) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
+	_, err = c.post(ctx, "/api/v1/ingest", body, attempts)
+	return err
+}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/ingest", bytes.NewReader(body))
+// SendBatch posts payloads to the batch ingest endpoint and returns the
+// server's per-item report. Retries follow the same policy as Send.
+func (c *Client) SendBatch(ctx context.Context, payloads []types.IngestPayload) (types.BatchResult, error) {
+	return c.sendBatch(ctx, payloads, c.retry.MaxAttempts)
+}
+
+func (c *Client) sendBatch(ctx context.Context, payloads []types.IngestPayload, attempts int) (types.BatchResult, error) {
+	var result types.BatchResult
+	body, err := json.Marshal(payloads)
 	if err != nil {
-		return err
+		return result, err
+	}
+	resp, err := c.post(ctx, "/api/v1/ingest/batch", body, attempts)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return result, fmt.Errorf("batch response: %w", err)
+	}
+	if len(result.Items) != len(payloads) {
+		return result, fmt.Errorf("batch response: got %d results for %d payloads", len(result.Items), len(payloads))
+	}
+	return result, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body []byte, attempts int) ([]byte, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var last *SendError
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := c.retry.backoff(attempt - 1)
+			if last.RetryAfter > delay {
+				delay = last.RetryAfter
+			}
+			// A long Retry-After would stall the sender; give up instead and
+			// let the spool hold the payload.
+			if c.retry.MaxDelay > 0 && delay > c.retry.MaxDelay {
+				return nil, last
+			}
+			if err := sleepCtx(ctx, delay); err != nil {
+				return nil, last
+			}
+		}
+
+		var resp []byte
+		resp, last = c.attempt(ctx, path, body)
+		if last == nil {
+			return resp, nil
+		}
+		last.Attempts = attempt
+		if !last.Retryable {
+			return nil, last
+		}
+	}
+	return nil, last
+}
+
+func (c *Client) attempt(ctx context.Context, path string, body []byte) ([]byte, *SendError) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, &SendError{Err: err}
 	}
 	if c.auth != "" {
 		req.Header.Set("Authorization", "Bearer "+c.auth)
@@ -41,12 +209,22 @@ func (c *Client) Send(payload types.IngestPayload) error {
 
 	resp, err := c.httpc.Do(req)
 	if err != nil {
-		return err
+		// Network level failures are worth retrying unless we are shutting down.
+		return nil, &SendError{Err: err, Retryable: ctx.Err() == nil}
 	}
 	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, &SendError{StatusCode: resp.StatusCode, Err: err, Retryable: ctx.Err() == nil}
+	}
 
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("ingest failed: %s", resp.Status)
+		return nil, &SendError{
+			StatusCode: resp.StatusCode,
+			Retryable:  retryableStatus(resp.StatusCode),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			Err:        fmt.Errorf("%s", resp.Status),
+		}
 	}
-	return nil
-}
\ No newline at end of file
+	return respBody, nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Send retries transient failures. Delays grow
+// exponentially from BaseDelay up to MaxDelay with random jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+}
+
+// backoff returns the delay before the given retry (1 for the first retry),
+// using "equal jitter": half the exponential step plus a random share of the
+// other half.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// SendError describes a send that did not succeed. StatusCode is zero when
+// no HTTP response was received.
+type SendError struct {
+	StatusCode int
+	Attempts   int
+	Retryable  bool
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("ingest failed after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Rejected reports whether the server refused the payload itself, meaning
+// resending the same body can never succeed. Auth failures are not
+// rejections: they clear up once the token is fixed.
+func (e *SendError) Rejected() bool {
+	if e.Retryable || e.StatusCode < 400 || e.StatusCode >= 500 {
+		return false
+	}
+	return e.StatusCode != http.StatusUnauthorized && e.StatusCode != http.StatusForbidden
+}
+
+// IsRejected reports whether err is a SendError for a payload the server
+// refused.
+func IsRejected(err error) bool {
+	var se *SendError
+	return errors.As(err, &se) && se.Rejected()
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"home-telemetry/agent/internal/types"
+)
+
+const spoolExt = ".json"
+
+// Spool is a bounded on-disk FIFO of payloads that could not be delivered.
+// Each payload is stored in its own file named after the time it was queued,
+// so directory order is replay order and a crash loses at most the file being
+// written.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu    sync.Mutex
+	files []spoolFile
+	bytes int64
+	seq   uint64
+}
+
+type spoolFile struct {
+	name   string
+	queued time.Time
+	size   int64
+}
+
+// OpenSpool opens (creating if needed) the spool in dir. Zero maxBytes or
+// maxAge disables that cap.
+func OpenSpool(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, spoolExt+".tmp") {
+			// Left behind by a crash mid-write.
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if e.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		queued, ok := parseSpoolName(name)
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, spoolFile{name: name, queued: queued, size: info.Size()})
+		s.bytes += info.Size()
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+
+	s.mu.Lock()
+	s.enforceLocked(time.Now())
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Len returns the number of queued payloads.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// Push appends p to the spool, evicting the oldest entries if a cap is hit.
+func (s *Spool) Push(p types.IngestPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d%s", now.UnixNano(), s.seq%1000000, spoolExt)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	s.files = append(s.files, spoolFile{name: name, queued: now, size: int64(len(body))})
+	s.bytes += int64(len(body))
+	s.enforceLocked(now)
+	return nil
+}
+
+// Replay sends queued payloads oldest first, removing each one after send
+// succeeds. Payloads the server rejects are dropped; any other error stops
+// the replay. It returns how many payloads were delivered.
+func (s *Spool) Replay(send func(types.IngestPayload) error) (int, error) {
+	sent := 0
+	for {
+		s.mu.Lock()
+		s.enforceLocked(time.Now())
+		if len(s.files) == 0 {
+			s.mu.Unlock()
+			return sent, nil
+		}
+		head := s.files[0]
+		s.mu.Unlock()
+
+		p, err := s.read(head)
+		if err != nil {
+			// Unreadable entries can never be delivered; drop them.
+			s.remove(head)
+			continue
+		}
+		err = send(p)
+		if err != nil && !IsRejected(err) {
+			return sent, err
+		}
+		s.remove(head)
+		if err == nil {
+			sent++
+		}
+	}
+}
+
+// ReplayBatch is Replay for the batch endpoint: it sends up to size queued
+// payloads per request and removes each item the server accepted or
+// rejected. Items that failed on the server side stay queued and end the
+// replay, so they are retried first next time.
+func (s *Spool) ReplayBatch(size int, send func([]types.IngestPayload) (types.BatchResult, error)) (int, error) {
+	sent := 0
+	for {
+		s.mu.Lock()
+		s.enforceLocked(time.Now())
+		n := min(size, len(s.files))
+		heads := append([]spoolFile(nil), s.files[:n]...)
+		s.mu.Unlock()
+		if len(heads) == 0 {
+			return sent, nil
+		}
+
+		var batch []types.IngestPayload
+		var files []spoolFile
+		for _, f := range heads {
+			p, err := s.read(f)
+			if err != nil {
+				s.remove(f)
+				continue
+			}
+			batch = append(batch, p)
+			files = append(files, f)
+		}
+		if len(batch) == 0 {
+			continue
+		}
+
+		result, err := send(batch)
+		if err != nil {
+			return sent, err
+		}
+		var failed error
+		for i, item := range result.Items {
+			if item.Status >= 500 {
+				if failed == nil {
+					failed = fmt.Errorf("batch item %d: %d %s", i, item.Status, item.Error)
+				}
+				continue
+			}
+			s.remove(files[i])
+			if item.Status < 300 {
+				sent++
+			}
+		}
+		if failed != nil {
+			return sent, failed
+		}
+	}
+}
+
+func (s *Spool) read(f spoolFile) (types.IngestPayload, error) {
+	var p types.IngestPayload
+	body, err := os.ReadFile(filepath.Join(s.dir, f.name))
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal(body, &p)
+	return p, err
+}
+
+func (s *Spool) remove(f spoolFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, cur := range s.files {
+		if cur.name == f.name {
+			s.dropLocked(i)
+			return
+		}
+	}
+}
+
+func (s *Spool) enforceLocked(now time.Time) {
+	for len(s.files) > 0 {
+		head := s.files[0]
+		tooOld := s.maxAge > 0 && now.Sub(head.queued) > s.maxAge
+		tooBig := s.maxBytes > 0 && s.bytes > s.maxBytes
+		if !tooOld && !tooBig {
+			return
+		}
+		s.dropLocked(0)
+	}
+}
+
+func (s *Spool) dropLocked(i int) {
+	f := s.files[i]
+	_ = os.Remove(filepath.Join(s.dir, f.name))
+	s.bytes -= f.size
+	s.files = append(s.files[:i], s.files[i+1:]...)
+}
+
+func parseSpoolName(name string) (time.Time, bool) {
+	stamp, _, ok := strings.Cut(strings.TrimSuffix(name, spoolExt), "-")
+	if !ok {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
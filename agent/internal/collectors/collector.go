@@ -0,0 +1,172 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"home-telemetry/agent/internal/types"
+)
+
+// Collector is a single data source. Collect adds whatever it measured to p.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context, p *types.IngestPayload) error
+}
+
+// Schedule controls how often a collector runs and how long a single
+// collection may take. Zero values fall back to the agent defaults.
+type Schedule struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type entry struct {
+	collector Collector
+	enabled   bool
+	schedule  Schedule
+}
+
+// Registry holds the known collectors in registration order.
+type Registry struct {
+	entries []*entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds c to the registry, enabled.
+func (r *Registry) Register(c Collector) {
+	r.entries = append(r.entries, &entry{collector: c, enabled: true})
+}
+
+func (r *Registry) Enable(name string) error {
+	return r.setEnabled(name, true)
+}
+
+func (r *Registry) Disable(name string) error {
+	return r.setEnabled(name, false)
+}
+
+func (r *Registry) setEnabled(name string, on bool) error {
+	e, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	e.enabled = on
+	return nil
+}
+
+func (r *Registry) lookup(name string) (*entry, error) {
+	for _, e := range r.entries {
+		if e.collector.Name() == name {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown collector %q (known: %s)", name, strings.Join(r.Names(), ", "))
+}
+
+// Configure applies comma separated enable/disable lists. An empty enable
+// list keeps every collector on; a non-empty one turns off anything not listed.
+func (r *Registry) Configure(enable, disable string) error {
+	if names := splitList(enable); len(names) > 0 {
+		for _, e := range r.entries {
+			e.enabled = false
+		}
+		for _, name := range names {
+			if err := r.Enable(name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range splitList(disable) {
+		if err := r.Disable(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigureSchedules applies comma separated name=duration lists, for
+// example "nvidia=2s,cpu=5s".
+func (r *Registry) ConfigureSchedules(intervals, timeouts string) error {
+	if err := r.applyDurations(intervals, func(s *Schedule, d time.Duration) { s.Interval = d }); err != nil {
+		return fmt.Errorf("intervals: %w", err)
+	}
+	if err := r.applyDurations(timeouts, func(s *Schedule, d time.Duration) { s.Timeout = d }); err != nil {
+		return fmt.Errorf("timeouts: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) applyDurations(list string, set func(*Schedule, time.Duration)) error {
+	for _, item := range splitList(list) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("expected name=duration, got %q", item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration for %s: %q", name, value)
+		}
+		e, err := r.lookup(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		set(&e.schedule, d)
+	}
+	return nil
+}
+
+func (r *Registry) Names() []string {
+	out := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, e.collector.Name())
+	}
+	return out
+}
+
+func (r *Registry) Enabled() []Collector {
+	var out []Collector
+	for _, e := range r.entries {
+		if e.enabled {
+			out = append(out, e.collector)
+		}
+	}
+	return out
+}
+
+// Jobs returns the enabled collectors with their schedules resolved against
+// def. A missing timeout defaults to the collector's interval.
+func (r *Registry) Jobs(def Schedule) []Job {
+	var out []Job
+	for _, e := range r.entries {
+		if !e.enabled {
+			continue
+		}
+		s := e.schedule
+		if s.Interval <= 0 {
+			s.Interval = def.Interval
+		}
+		if s.Timeout <= 0 {
+			s.Timeout = def.Timeout
+		}
+		if s.Timeout <= 0 {
+			s.Timeout = s.Interval
+		}
+		out = append(out, Job{Collector: e.collector, Schedule: s})
+	}
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
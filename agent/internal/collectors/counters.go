@@ -0,0 +1,12 @@
+package collectors
+
+// counterDelta returns how much a cumulative counter grew from prev to cur.
+// A counter that went down was reset (device reappeared, driver reloaded) or
+// wrapped; the two cannot be told apart reliably, so ok is false and the
+// caller skips that sample.
+func counterDelta(prev, cur uint64) (delta uint64, ok bool) {
+	if cur < prev {
+		return 0, false
+	}
+	return cur - prev, true
+}
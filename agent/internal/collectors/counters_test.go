@@ -0,0 +1,23 @@
+package collectors
+
+import "testing"
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		prev, cur uint64
+		want      uint64
+		ok        bool
+	}{
+		{100, 250, 150, true},
+		{100, 100, 0, true},
+		{3e9, 1000, 0, false},     // 64-bit counter reset
+		{1<<32 - 10, 5, 0, false}, // 32-bit wrap
+		{1 << 40, 1<<40 + 1, 1, true},
+	}
+	for _, tt := range tests {
+		got, ok := counterDelta(tt.prev, tt.cur)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("counterDelta(%d, %d) = %d, %v; want %d, %v", tt.prev, tt.cur, got, ok, tt.want, tt.ok)
+		}
+	}
+}
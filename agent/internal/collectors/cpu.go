@@ -1,6 +1,7 @@
 package collectors
 
 import (
+	"context"
 	"runtime"
 	"time"
 
@@ -9,23 +10,63 @@ import (
 	"home-telemetry/agent/internal/types"
 )
 
-func CollectCPU(lhmURL string) (*types.CPUMetrics, error) {
-	percent, err := cpu.Percent(1*time.Second, false)
+type cpuCollector struct {
+	lhmURL   string
+	sysClass string
+	primed   bool
+}
+
+// NewCPU reports usage and temperature. The temperature comes from
+// LibreHardwareMonitor when lhmURL answers, otherwise from Linux hwmon and
+// thermal zones, which also add a cpu.sensor_temp_c sample per sensor.
+func NewCPU(lhmURL string) Collector {
+	return &cpuCollector{lhmURL: lhmURL, sysClass: DefaultSysClass}
+}
+
+func (c *cpuCollector) Name() string { return "cpu" }
+
+func (c *cpuCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	// The first sample needs a measurement window; after that usage is
+	// computed against the previous call so Collect returns immediately.
+	window := time.Duration(0)
+	if !c.primed {
+		window = time.Second
+	}
+	metrics, err := CollectCPU(ctx, c.lhmURL, window)
+	if err != nil {
+		return err
+	}
+	c.primed = true
+
+	if metrics.TempC == nil {
+		if temp, sensors, ok := CPUTempFromSysfs(c.sysClass); ok {
+			metrics.TempC = types.Float(temp)
+			for _, s := range sensors {
+				p.AddSample("cpu.sensor_temp_c", s.TempC, "C", map[string]string{"device": s.Device, "chip": s.Chip, "sensor": s.Label})
+			}
+		}
+	}
+	p.CPU = metrics
+	return nil
+}
+
+func CollectCPU(ctx context.Context, lhmURL string, window time.Duration) (*types.CPUMetrics, error) {
+	percent, err := cpu.PercentWithContext(ctx, window, false)
 	if err != nil || len(percent) == 0 {
 		return nil, err
 	}
 
 	cores := runtime.NumCPU()
 	metrics := &types.CPUMetrics{
-		UsagePct: percent[0],
+		UsagePct: types.Float(percent[0]),
 		Cores:    cores,
 	}
 
 	if lhmURL != "" {
-		if temp, err := CollectCPUTempFromLHM(lhmURL); err == nil {
-			metrics.TempC = temp
+		if temp, err := CollectCPUTempFromLHM(ctx, lhmURL); err == nil {
+			metrics.TempC = types.Float(temp)
 		}
 	}
 
 	return metrics, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,155 @@
+package collectors
+
+import (
+	"context"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"home-telemetry/agent/internal/types"
+)
+
+// DefaultDiskExcludeFSTypes lists pseudo and in-memory filesystems that are
+// not worth reporting space for.
+const DefaultDiskExcludeFSTypes = "tmpfs,devtmpfs,ramfs,overlay,squashfs,autofs,proc,sysfs,cgroup,cgroup2,devpts,mqueue,debugfs,tracefs,securityfs,pstore,bpf,configfs,fusectl,hugetlbfs,binfmt_misc,nsfs,efivarfs,rpc_pipefs,nfsd"
+
+type diskCollector struct {
+	include   *regexp.Regexp
+	exclude   *regexp.Regexp
+	excludeFS map[string]bool
+
+	prev     map[string]disk.IOCountersStat
+	prevTime time.Time
+}
+
+// NewDisk reports space and inode usage per mountpoint and I/O rates per
+// device. include and exclude are optional regular expressions matched
+// against the mountpoint; excludeFS is a comma separated list of filesystem
+// types to skip.
+func NewDisk(include, exclude, excludeFS string) (Collector, error) {
+	c := &diskCollector{excludeFS: map[string]bool{}}
+	var err error
+	if include != "" {
+		if c.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if c.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	for _, fs := range strings.Split(excludeFS, ",") {
+		if fs = strings.TrimSpace(fs); fs != "" {
+			c.excludeFS[strings.ToLower(fs)] = true
+		}
+	}
+	return c, nil
+}
+
+func (c *diskCollector) Name() string { return "disk" }
+
+func (c *diskCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	if err := c.collectUsage(ctx, p); err != nil {
+		return err
+	}
+	// I/O counters are unavailable in some containers and VMs; that must
+	// not cost the space samples, so their errors are ignored.
+	c.collectIO(ctx, p)
+	return nil
+}
+
+func (c *diskCollector) wantMount(part disk.PartitionStat) bool {
+	if c.excludeFS[strings.ToLower(part.Fstype)] {
+		return false
+	}
+	if c.include != nil && !c.include.MatchString(part.Mountpoint) {
+		return false
+	}
+	return c.exclude == nil || !c.exclude.MatchString(part.Mountpoint)
+}
+
+func (c *diskCollector) collectUsage(ctx context.Context, p *types.IngestPayload) error {
+	// all=true so that the fstype list, not gopsutil, decides what is skipped.
+	parts, err := disk.PartitionsWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, part := range parts {
+		if seen[part.Mountpoint] || !c.wantMount(part) {
+			continue
+		}
+		seen[part.Mountpoint] = true
+
+		usage, err := disk.UsageWithContext(ctx, part.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			// Unreadable mounts (permissions, stale network shares) are
+			// skipped rather than failing the whole collection.
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		labels := map[string]string{"mountpoint": part.Mountpoint, "device": part.Device, "fstype": part.Fstype}
+		p.AddSample("disk.total_bytes", float64(usage.Total), "B", labels)
+		p.AddSample("disk.used_bytes", float64(usage.Used), "B", labels)
+		p.AddSample("disk.free_bytes", float64(usage.Free), "B", labels)
+		p.AddSample("disk.used_pct", usage.UsedPercent, "%", labels)
+		if usage.InodesTotal > 0 {
+			p.AddSample("disk.inodes_total", float64(usage.InodesTotal), "", labels)
+			p.AddSample("disk.inodes_used", float64(usage.InodesUsed), "", labels)
+			p.AddSample("disk.inodes_free", float64(usage.InodesFree), "", labels)
+			p.AddSample("disk.inodes_used_pct", usage.InodesUsedPercent, "%", labels)
+		}
+	}
+	return nil
+}
+
+// collectIO reports rates since the previous call, so the first call only
+// records the counters.
+func (c *diskCollector) collectIO(ctx context.Context, p *types.IngestPayload) {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	prev, elapsed := c.prev, now.Sub(c.prevTime).Seconds()
+	c.prev, c.prevTime = counters, now
+	if prev == nil || elapsed <= 0 {
+		return
+	}
+
+	for name, cur := range counters {
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		old, ok := prev[name]
+		if !ok {
+			continue
+		}
+		readBytes, ok1 := counterDelta(old.ReadBytes, cur.ReadBytes)
+		writeBytes, ok2 := counterDelta(old.WriteBytes, cur.WriteBytes)
+		reads, ok3 := counterDelta(old.ReadCount, cur.ReadCount)
+		writes, ok4 := counterDelta(old.WriteCount, cur.WriteCount)
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			continue
+		}
+		labels := map[string]string{"device": name}
+		p.AddSample("disk.read_bytes_per_s", float64(readBytes)/elapsed, "B/s", labels)
+		p.AddSample("disk.write_bytes_per_s", float64(writeBytes)/elapsed, "B/s", labels)
+		p.AddSample("disk.reads_per_s", float64(reads)/elapsed, "ops/s", labels)
+		p.AddSample("disk.writes_per_s", float64(writes)/elapsed, "ops/s", labels)
+
+		// gopsutil does not report busy time on Windows.
+		if runtime.GOOS == "windows" {
+			continue
+		}
+		if busy, ok := counterDelta(old.IoTime, cur.IoTime); ok {
+			p.AddSample("disk.busy_pct", min(float64(busy)/(elapsed*1000)*100, 100), "%", labels)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSysClass is where Linux exposes hwmon and thermal devices.
+const DefaultSysClass = "/sys/class"
+
+// ThermalSensor is one temperature reading from sysfs.
+type ThermalSensor struct {
+	Device string // hwmonN or thermal_zoneN, telling apart chips of the same kind
+	Chip   string // hwmon driver name or thermal zone type
+	Label  string // sensor label such as "Package id 0", "Core 3" or "Tctl"
+	TempC  float64
+}
+
+// cpuChips are hwmon drivers that report CPU temperatures.
+var cpuChips = map[string]bool{
+	"coretemp":    true, // Intel
+	"k10temp":     true, // AMD
+	"zenpower":    true, // AMD, out of tree
+	"cpu_thermal": true, // Raspberry Pi and other SoCs
+}
+
+// ReadHwmonTemps reads every tempN_input of every hwmon device under
+// sysClass/hwmon. Sensors without a tempN_label are labelled tempN.
+func ReadHwmonTemps(sysClass string) []ThermalSensor {
+	devices, _ := filepath.Glob(filepath.Join(sysClass, "hwmon", "hwmon*"))
+	sort.Slice(devices, func(i, j int) bool { return sensorIndex(devices[i]) < sensorIndex(devices[j]) })
+
+	var out []ThermalSensor
+	for _, dev := range devices {
+		dir := dev
+		name := readTrimmed(filepath.Join(dev, "name"))
+		if name == "" {
+			// Older drivers keep their attributes on the parent device.
+			dir = filepath.Join(dev, "device")
+			name = readTrimmed(filepath.Join(dir, "name"))
+		}
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		sort.Slice(inputs, func(i, j int) bool { return sensorIndex(inputs[i]) < sensorIndex(inputs[j]) })
+		for _, input := range inputs {
+			milli, ok := readInt(input)
+			if !ok {
+				continue
+			}
+			base := strings.TrimSuffix(filepath.Base(input), "_input")
+			label := readTrimmed(filepath.Join(dir, base+"_label"))
+			if label == "" {
+				label = base
+			}
+			out = append(out, ThermalSensor{Device: filepath.Base(dev), Chip: name, Label: label, TempC: float64(milli) / 1000})
+		}
+	}
+	return out
+}
+
+// ReadThermalZones reads sysClass/thermal/thermal_zone*, labelled by zone.
+func ReadThermalZones(sysClass string) []ThermalSensor {
+	zones, _ := filepath.Glob(filepath.Join(sysClass, "thermal", "thermal_zone*"))
+	sort.Slice(zones, func(i, j int) bool { return sensorIndex(zones[i]) < sensorIndex(zones[j]) })
+
+	var out []ThermalSensor
+	for _, zone := range zones {
+		milli, ok := readInt(filepath.Join(zone, "temp"))
+		if !ok {
+			continue
+		}
+		out = append(out, ThermalSensor{
+			Device: filepath.Base(zone),
+			Chip:   readTrimmed(filepath.Join(zone, "type")),
+			Label:  filepath.Base(zone),
+			TempC:  float64(milli) / 1000,
+		})
+	}
+	return out
+}
+
+// CPUTempFromSysfs returns the CPU sensors under sysClass and the single
+// temperature that best represents the CPU: the hottest Intel package,
+// AMD Tdie (or Tctl), else the hottest CPU sensor. Thermal zones are used
+// only when no CPU hwmon driver is present. ok is false when nothing was
+// found, for example on Windows.
+func CPUTempFromSysfs(sysClass string) (temp float64, sensors []ThermalSensor, ok bool) {
+	for _, s := range ReadHwmonTemps(sysClass) {
+		if cpuChips[s.Chip] {
+			sensors = append(sensors, s)
+		}
+	}
+	if len(sensors) == 0 {
+		for _, s := range ReadThermalZones(sysClass) {
+			if s.Chip == "x86_pkg_temp" || strings.Contains(strings.ToLower(s.Chip), "cpu") {
+				sensors = append(sensors, s)
+			}
+		}
+	}
+	if len(sensors) == 0 {
+		return 0, nil, false
+	}
+
+	for _, prefer := range []func(ThermalSensor) bool{
+		func(s ThermalSensor) bool { return strings.HasPrefix(s.Label, "Package id") },
+		func(s ThermalSensor) bool { return s.Chip == "x86_pkg_temp" },
+		func(s ThermalSensor) bool { return s.Label == "Tdie" },
+		func(s ThermalSensor) bool { return s.Label == "Tctl" },
+		func(ThermalSensor) bool { return true },
+	} {
+		found := false
+		for _, s := range sensors {
+			if prefer(s) && (!found || s.TempC > temp) {
+				temp, found = s.TempC, true
+			}
+		}
+		if found {
+			return temp, sensors, true
+		}
+	}
+	return 0, sensors, false
+}
+
+func readTrimmed(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readInt(path string) (int64, bool) {
+	v, err := strconv.ParseInt(readTrimmed(path), 10, 64)
+	return v, err == nil
+}
+
+// sensorIndex extracts N from names like temp12_input, hwmon3 or
+// thermal_zone2 so they sort numerically.
+func sensorIndex(path string) int {
+	base := filepath.Base(path)
+	start := strings.IndexAny(base, "0123456789")
+	if start < 0 {
+		return 0
+	}
+	end := start
+	for end < len(base) && base[end] >= '0' && base[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(base[start:end])
+	return n
+}
@@ -0,0 +1,171 @@
+package collectors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates files under root; keys are slash separated paths
+// relative to root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCPUTempFromSysfs(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    float64
+		sensors []ThermalSensor
+	}{
+		{
+			name: "k10temp prefers Tdie over Tctl",
+			files: map[string]string{
+				"hwmon/hwmon0/name":        "nvme",
+				"hwmon/hwmon0/temp1_input": "38850",
+				"hwmon/hwmon1/name":        "k10temp",
+				"hwmon/hwmon1/temp1_input": "61500",
+				"hwmon/hwmon1/temp1_label": "Tctl",
+				"hwmon/hwmon1/temp2_input": "51500",
+				"hwmon/hwmon1/temp2_label": "Tdie",
+			},
+			want: 51.5,
+			sensors: []ThermalSensor{
+				{Device: "hwmon1", Chip: "k10temp", Label: "Tctl", TempC: 61.5},
+				{Device: "hwmon1", Chip: "k10temp", Label: "Tdie", TempC: 51.5},
+			},
+		},
+		{
+			name: "k10temp with only Tctl",
+			files: map[string]string{
+				"hwmon/hwmon2/name":        "k10temp",
+				"hwmon/hwmon2/temp1_input": "47000",
+				"hwmon/hwmon2/temp1_label": "Tctl",
+				"hwmon/hwmon2/temp3_input": "55000",
+				"hwmon/hwmon2/temp3_label": "Tccd1",
+			},
+			want: 47,
+			sensors: []ThermalSensor{
+				{Device: "hwmon2", Chip: "k10temp", Label: "Tctl", TempC: 47},
+				{Device: "hwmon2", Chip: "k10temp", Label: "Tccd1", TempC: 55},
+			},
+		},
+		{
+			name: "coretemp package and cores on two sockets",
+			files: map[string]string{
+				"hwmon/hwmon1/name":         "coretemp",
+				"hwmon/hwmon1/temp1_input":  "45000",
+				"hwmon/hwmon1/temp1_label":  "Package id 0",
+				"hwmon/hwmon1/temp2_input":  "43000",
+				"hwmon/hwmon1/temp2_label":  "Core 0",
+				"hwmon/hwmon1/temp10_input": "44000",
+				"hwmon/hwmon1/temp10_label": "Core 8",
+				"hwmon/hwmon2/name":         "coretemp",
+				"hwmon/hwmon2/temp1_input":  "52000",
+				"hwmon/hwmon2/temp1_label":  "Package id 1",
+				"hwmon/hwmon2/temp2_input":  "58000",
+				"hwmon/hwmon2/temp2_label":  "Core 0",
+			},
+			want: 52,
+			sensors: []ThermalSensor{
+				{Device: "hwmon1", Chip: "coretemp", Label: "Package id 0", TempC: 45},
+				{Device: "hwmon1", Chip: "coretemp", Label: "Core 0", TempC: 43},
+				{Device: "hwmon1", Chip: "coretemp", Label: "Core 8", TempC: 44},
+				{Device: "hwmon2", Chip: "coretemp", Label: "Package id 1", TempC: 52},
+				{Device: "hwmon2", Chip: "coretemp", Label: "Core 0", TempC: 58},
+			},
+		},
+		{
+			name: "attributes on the parent device",
+			files: map[string]string{
+				"hwmon/hwmon0/device/name":        "coretemp",
+				"hwmon/hwmon0/device/temp1_input": "40000",
+				"hwmon/hwmon0/device/temp1_label": "Core 0",
+				"hwmon/hwmon0/device/temp2_input": "42000",
+			},
+			want: 42,
+			sensors: []ThermalSensor{
+				{Device: "hwmon0", Chip: "coretemp", Label: "Core 0", TempC: 40},
+				{Device: "hwmon0", Chip: "coretemp", Label: "temp2", TempC: 42},
+			},
+		},
+		{
+			name: "thermal zone fallback",
+			files: map[string]string{
+				"hwmon/hwmon0/name":             "acpitz",
+				"hwmon/hwmon0/temp1_input":      "27800",
+				"thermal/thermal_zone0/type":    "acpitz",
+				"thermal/thermal_zone0/temp":    "27800",
+				"thermal/thermal_zone1/type":    "x86_pkg_temp",
+				"thermal/thermal_zone1/temp":    "49000",
+				"thermal/thermal_zone2/type":    "cpu-thermal",
+				"thermal/thermal_zone2/temp":    "55000",
+				"thermal/thermal_zone10/type":   "iwlwifi_1",
+				"thermal/thermal_zone10/temp":   "40000",
+				"thermal/cooling_device0/type":  "Processor",
+				"thermal/cooling_device0/state": "0",
+			},
+			want: 49,
+			sensors: []ThermalSensor{
+				{Device: "thermal_zone1", Chip: "x86_pkg_temp", Label: "thermal_zone1", TempC: 49},
+				{Device: "thermal_zone2", Chip: "cpu-thermal", Label: "thermal_zone2", TempC: 55},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, tt.files)
+
+			temp, sensors, ok := CPUTempFromSysfs(root)
+			if !ok {
+				t.Fatal("ok = false, want true")
+			}
+			if temp != tt.want {
+				t.Errorf("temp = %v, want %v", temp, tt.want)
+			}
+			if len(sensors) != len(tt.sensors) {
+				t.Fatalf("sensors = %+v, want %+v", sensors, tt.sensors)
+			}
+			for i := range sensors {
+				if sensors[i] != tt.sensors[i] {
+					t.Errorf("sensors[%d] = %+v, want %+v", i, sensors[i], tt.sensors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCPUTempFromSysfsNoCPUSensors(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"empty": {},
+		"other chips only": {
+			"hwmon/hwmon0/name":          "nvme",
+			"hwmon/hwmon0/temp1_input":   "38850",
+			"hwmon/hwmon1/name":          "coretemp",
+			"hwmon/hwmon1/temp1_input":   "not a number",
+			"thermal/thermal_zone0/type": "acpitz",
+			"thermal/thermal_zone0/temp": "27800",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, files)
+
+			if temp, sensors, ok := CPUTempFromSysfs(root); ok {
+				t.Errorf("got %v, %+v, ok = true; want ok = false", temp, sensors)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package collectors
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 type lhmNode struct {
 	Text     string    `json:"Text"`
 	Value    string    `json:"Value"`
+	Type     string    `json:"Type"` // set on sensors by newer LHM versions
 	Children []lhmNode `json:"Children"`
 }
 
@@ -19,38 +21,15 @@ type lhmRoot struct {
 	Children []lhmNode `json:"Children"`
 }
 
-func CollectCPUTempFromLHM(url string) (float64, error) {
-	if url == "" {
-		return 0, errors.New("lhm url empty")
-	}
-
-	client := &http.Client{Timeout: 3 * time.Second}
-	resp, err := client.Get(url)
+func CollectCPUTempFromLHM(ctx context.Context, url string) (float64, error) {
+	root, err := fetchLHM(ctx, url)
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return 0, errors.New("lhm http status: " + resp.Status)
-	}
-
-	var root lhmRoot
-	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
-		return 0, err
-	}
 
 	max := 0.0
 	found := false
-	walk := func(n lhmNode, path []string, visit func(n lhmNode, path []string)) {}
-	walk = func(n lhmNode, path []string, visit func(n lhmNode, path []string)) {
-		visit(n, path)
-		for _, c := range n.Children {
-			walk(c, append(path, n.Text), visit)
-		}
-	}
-
-	visit := func(n lhmNode, path []string) {
+	walkLHM(root, func(n lhmNode, path []string) {
 		// Look for temperature sensors under CPU
 		pathStr := strings.ToLower(strings.Join(append(path, n.Text), "/"))
 		if !strings.Contains(pathStr, "cpu") {
@@ -69,11 +48,7 @@ func CollectCPUTempFromLHM(url string) (float64, error) {
 				found = true
 			}
 		}
-	}
-
-	for _, c := range root.Children {
-		walk(c, nil, visit)
-	}
+	})
 
 	if !found {
 		return 0, errors.New("cpu temp not found")
@@ -81,6 +56,45 @@ func CollectCPUTempFromLHM(url string) (float64, error) {
 	return max, nil
 }
 
+func fetchLHM(ctx context.Context, url string) (lhmRoot, error) {
+	var root lhmRoot
+	if url == "" {
+		return root, errors.New("lhm url empty")
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return root, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return root, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return root, errors.New("lhm http status: " + resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&root)
+	return root, err
+}
+
+// walkLHM calls visit for every node with the texts of its ancestors.
+func walkLHM(root lhmRoot, visit func(n lhmNode, path []string)) {
+	var walk func(n lhmNode, path []string)
+	walk = func(n lhmNode, path []string) {
+		visit(n, path)
+		for _, c := range n.Children {
+			walk(c, append(path[:len(path):len(path)], n.Text))
+		}
+	}
+	for _, c := range root.Children {
+		walk(c, nil)
+	}
+}
+
 func parseTempC(s string) float64 {
 	// Value format: "45.0 °C"
 	clean := strings.Builder{}
@@ -91,4 +105,4 @@ func parseTempC(s string) float64 {
 	}
 	v, _ := strconv.ParseFloat(clean.String(), 64)
 	return v
-}
\ No newline at end of file
+}
@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"home-telemetry/agent/internal/types"
+)
+
+// lhmGroups maps LibreHardwareMonitor sensor group names to the metric
+// suffix used for their sensors.
+var lhmGroups = map[string]string{
+	"Temperatures": "temperature",
+	"Voltages":     "voltage",
+	"Currents":     "current",
+	"Clocks":       "clock",
+	"Frequencies":  "frequency",
+	"Load":         "load",
+	"Fans":         "fan",
+	"Controls":     "control",
+	"Powers":       "power",
+	"Energy":       "energy",
+	"Data":         "data",
+	"SmallData":    "data",
+	"Throughput":   "throughput",
+	"Levels":       "level",
+	"Factors":      "factor",
+	"Noise":        "noise",
+	"Timing":       "timing",
+}
+
+type lhmCollector struct {
+	url     string
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// NewLHM reports every LibreHardwareMonitor sensor as a sample named
+// lhm.<type> (lhm.temperature, lhm.fan, lhm.voltage, ...) labelled with the
+// hardware path and sensor name. include and exclude are optional regular
+// expressions matched against "hardware path/group/sensor", for example
+// "AMD Ryzen 7 5800X/Temperatures/Core (Tctl/Tdie)".
+func NewLHM(url, include, exclude string) (Collector, error) {
+	c := &lhmCollector{url: url}
+	var err error
+	if include != "" {
+		if c.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if c.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *lhmCollector) Name() string { return "lhm" }
+
+func (c *lhmCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	root, err := fetchLHM(ctx, c.url)
+	if err != nil {
+		return err
+	}
+
+	walkLHM(root, func(n lhmNode, path []string) {
+		// Sensors are leaves below computer/hardware.../group.
+		if n.Value == "" || len(n.Children) > 0 || len(path) < 3 {
+			return
+		}
+		group := path[len(path)-1]
+		hardware := strings.Join(path[1:len(path)-1], "/")
+		full := hardware + "/" + group + "/" + n.Text
+		if c.include != nil && !c.include.MatchString(full) {
+			return
+		}
+		if c.exclude != nil && c.exclude.MatchString(full) {
+			return
+		}
+
+		value, unit, ok := parseLHMValue(n.Value)
+		if !ok {
+			return
+		}
+		kind, ok := lhmGroups[group]
+		if !ok {
+			kind = strings.ToLower(strings.ReplaceAll(group, " ", "_"))
+		}
+		if n.Type != "" {
+			kind = strings.ToLower(n.Type)
+		}
+		p.AddSample("lhm."+kind, value, unit, map[string]string{
+			"hardware": hardware,
+			"sensor":   n.Text,
+		})
+	})
+	return nil
+}
+
+// parseLHMValue splits values such as "45.0 °C", "1,250 V" or "1200 RPM"
+// into number and unit. LHM formats numbers with the machine's locale, so
+// a lone comma is taken as the decimal separator.
+func parseLHMValue(s string) (float64, string, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && strings.IndexByte("0123456789.,-+", s[end]) >= 0 {
+		end++
+	}
+	num := s[:end]
+	if !strings.Contains(num, ".") && strings.Count(num, ",") == 1 {
+		num = strings.Replace(num, ",", ".", 1)
+	} else {
+		num = strings.ReplaceAll(num, ",", "")
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	unit := strings.TrimSpace(s[end:])
+	unit = strings.TrimPrefix(unit, "°")
+	return v, unit, true
+}
@@ -0,0 +1,55 @@
+package collectors
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"home-telemetry/agent/internal/types"
+)
+
+type memCollector struct{}
+
+// NewMem reports physical memory and swap usage.
+func NewMem() Collector {
+	return memCollector{}
+}
+
+func (memCollector) Name() string { return "mem" }
+
+func (memCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	metrics, err := CollectMem(ctx)
+	if err != nil {
+		return err
+	}
+	p.Mem = metrics
+	return nil
+}
+
+// CollectMem reads memory usage. Swap is left out when it cannot be read,
+// e.g. inside some containers.
+func CollectMem(ctx context.Context) (*types.MemMetrics, error) {
+	vm, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := &types.MemMetrics{
+		TotalBytes:     types.Float(float64(vm.Total)),
+		UsedBytes:      types.Float(float64(vm.Used)),
+		AvailableBytes: types.Float(float64(vm.Available)),
+		UsedPct:        types.Float(vm.UsedPercent),
+	}
+	// gopsutil does not fill Cached on Windows.
+	if vm.Cached > 0 {
+		metrics.CachedBytes = types.Float(float64(vm.Cached))
+	}
+
+	if swap, err := mem.SwapMemoryWithContext(ctx); err == nil {
+		metrics.SwapTotalBytes = types.Float(float64(swap.Total))
+		metrics.SwapUsedBytes = types.Float(float64(swap.Used))
+		if swap.Total > 0 {
+			metrics.SwapUsedPct = types.Float(swap.UsedPercent)
+		}
+	}
+	return metrics, nil
+}
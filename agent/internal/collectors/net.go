@@ -0,0 +1,110 @@
+package collectors
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+
+	"home-telemetry/agent/internal/types"
+)
+
+// DefaultNetExclude skips loopback, Docker and libvirt bridges and
+// container veth pairs.
+const DefaultNetExclude = `^(lo$|docker|veth|br-|virbr)|Loopback`
+
+type netCollector struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+
+	prev     map[string]net.IOCountersStat
+	prevTime time.Time
+}
+
+// NewNet reports per-interface throughput, packet, error and drop rates.
+// include and exclude are optional regular expressions matched against the
+// interface name.
+func NewNet(include, exclude string) (Collector, error) {
+	c := &netCollector{}
+	var err error
+	if include != "" {
+		if c.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if c.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *netCollector) Name() string { return "net" }
+
+func (c *netCollector) wantInterface(name string) bool {
+	if c.include != nil && !c.include.MatchString(name) {
+		return false
+	}
+	return c.exclude == nil || !c.exclude.MatchString(name)
+}
+
+// Collect reports rates since the previous call, so the first call only
+// records the counters.
+func (c *netCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	cur := make(map[string]net.IOCountersStat, len(counters))
+	for _, ifc := range counters {
+		if c.wantInterface(ifc.Name) {
+			cur[ifc.Name] = ifc
+		}
+	}
+	prev, elapsed := c.prev, now.Sub(c.prevTime).Seconds()
+	c.prev, c.prevTime = cur, now
+	if prev == nil || elapsed <= 0 {
+		return nil
+	}
+
+	for name, ifc := range cur {
+		old, ok := prev[name]
+		if !ok {
+			continue
+		}
+		rates := []struct {
+			metric    string
+			unit      string
+			prev, cur uint64
+		}{
+			{"net.rx_bytes_per_s", "B/s", old.BytesRecv, ifc.BytesRecv},
+			{"net.tx_bytes_per_s", "B/s", old.BytesSent, ifc.BytesSent},
+			{"net.rx_packets_per_s", "packets/s", old.PacketsRecv, ifc.PacketsRecv},
+			{"net.tx_packets_per_s", "packets/s", old.PacketsSent, ifc.PacketsSent},
+			{"net.rx_errors_per_s", "packets/s", old.Errin, ifc.Errin},
+			{"net.tx_errors_per_s", "packets/s", old.Errout, ifc.Errout},
+			{"net.rx_drops_per_s", "packets/s", old.Dropin, ifc.Dropin},
+			{"net.tx_drops_per_s", "packets/s", old.Dropout, ifc.Dropout},
+		}
+		deltas := make([]uint64, len(rates))
+		reset := false
+		for i, r := range rates {
+			if deltas[i], ok = counterDelta(r.prev, r.cur); !ok {
+				reset = true
+			}
+		}
+		// A reset interface (driver reload, link recreated with the same
+		// name) has no meaningful rate until the next round.
+		if reset {
+			continue
+		}
+		labels := map[string]string{"interface": name}
+		for i, r := range rates {
+			p.AddSample(r.metric, float64(deltas[i])/elapsed, r.unit, labels)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package collectors
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -9,8 +10,25 @@ import (
 	"home-telemetry/agent/internal/types"
 )
 
-func CollectNvidia() ([]types.GPUMetrics, error) {
-	cmd := exec.Command("nvidia-smi",
+type nvidiaCollector struct{}
+
+func NewNvidia() Collector {
+	return nvidiaCollector{}
+}
+
+func (nvidiaCollector) Name() string { return "nvidia" }
+
+func (nvidiaCollector) Collect(ctx context.Context, p *types.IngestPayload) error {
+	gpus, err := CollectNvidia(ctx)
+	if err != nil {
+		return err
+	}
+	p.GPUs = append(p.GPUs, gpus...)
+	return nil
+}
+
+func CollectNvidia(ctx context.Context) ([]types.GPUMetrics, error) {
+	cmd := exec.CommandContext(ctx, "nvidia-smi",
 		"--query-gpu=name,temperature.gpu,utilization.gpu,memory.used,power.draw",
 		"--format=csv,noheader,nounits",
 	)
@@ -28,10 +46,10 @@ func CollectNvidia() ([]types.GPUMetrics, error) {
 			continue
 		}
 		name := strings.TrimSpace(parts[0])
-		temp := parseFloat(parts[1])
-		util := parseFloat(parts[2])
-		mem := parseFloat(parts[3])
-		power := parseFloat(parts[4])
+		temp := parseMeasured(parts[1])
+		util := parseMeasured(parts[2])
+		mem := parseMeasured(parts[3])
+		power := parseMeasured(parts[4])
 
 		gpus = append(gpus, types.GPUMetrics{
 			Name:      name,
@@ -45,7 +63,12 @@ func CollectNvidia() ([]types.GPUMetrics, error) {
 	return gpus, nil
 }
 
-func parseFloat(s string) float64 {
-	v, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
-	return v
-}
\ No newline at end of file
+// parseMeasured returns nil for fields nvidia-smi could not read, which it
+// reports as "[N/A]" or "[Not Supported]".
+func parseMeasured(s string) *float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
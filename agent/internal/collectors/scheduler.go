@@ -0,0 +1,92 @@
+package collectors
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"home-telemetry/agent/internal/types"
+)
+
+// Job is an enabled collector paired with its resolved schedule.
+type Job struct {
+	Collector
+	Schedule
+}
+
+// Scheduler runs each job in its own goroutine so a slow collector only
+// delays itself. Every collection produces its own payload via NewPayload and
+// is handed to Emit.
+type Scheduler struct {
+	NewPayload func() types.IngestPayload
+	Emit       func(types.IngestPayload)
+	Logger     *log.Logger
+}
+
+// Run blocks until ctx is cancelled and all job goroutines have returned.
+func (s *Scheduler) Run(ctx context.Context, jobs []Job) {
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		if payload, ok := s.collect(ctx, job); ok {
+			s.Emit(payload)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs every job concurrently a single time and merges the results
+// into one payload.
+func (s *Scheduler) RunOnce(ctx context.Context, jobs []Job) types.IngestPayload {
+	merged := s.NewPayload()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			if payload, ok := s.collect(ctx, job); ok {
+				mu.Lock()
+				merged.Merge(payload)
+				mu.Unlock()
+			}
+		}(job)
+	}
+	wg.Wait()
+	return merged
+}
+
+func (s *Scheduler) collect(ctx context.Context, job Job) (types.IngestPayload, bool) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	payload := s.NewPayload()
+	start := time.Now()
+	if err := job.Collect(ctx, &payload); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			s.Logger.Printf("%s timed out after %s", job.Name(), time.Since(start).Round(time.Millisecond))
+		} else {
+			s.Logger.Printf("%s error: %v", job.Name(), err)
+		}
+		return payload, false
+	}
+	return payload, !payload.Empty()
+}
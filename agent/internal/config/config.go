@@ -3,7 +3,11 @@ package config
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
+
+	"home-telemetry/agent/internal/collectors"
 )
 
 type Config struct {
@@ -14,6 +18,29 @@ type Config struct {
 	Once      bool
 	PrintOnly bool
 	LHMURL    string
+
+	LHMInclude string
+	LHMExclude string
+
+	DiskInclude        string
+	DiskExclude        string
+	DiskExcludeFSTypes string
+
+	NetInclude string
+	NetExclude string
+
+	Collectors         string
+	DisableCollectors  string
+	CollectorIntervals string
+	CollectorTimeouts  string
+
+	SpoolDir      string
+	SpoolMaxBytes int64
+	SpoolMaxAge   time.Duration
+
+	RetryAttempts int
+	RetryBase     time.Duration
+	RetryMax      time.Duration
 }
 
 func Load() Config {
@@ -21,10 +48,27 @@ func Load() Config {
 	token := env("AUTH_TOKEN", "dev-token")
 	node := env("NODE_ID", host())
 	intervalStr := env("INTERVAL", "5s")
-	interval := mustDuration(intervalStr)
+	interval := mustDuration(intervalStr, 5*time.Second)
 	once := false
 	printOnly := false
 	lhmURL := env("LHM_URL", "http://localhost:8085/data.json")
+	lhmInclude := env("LHM_INCLUDE", "")
+	lhmExclude := env("LHM_EXCLUDE", "")
+	diskInclude := env("DISK_INCLUDE", "")
+	diskExclude := env("DISK_EXCLUDE", "")
+	diskExcludeFS := env("DISK_EXCLUDE_FSTYPES", collectors.DefaultDiskExcludeFSTypes)
+	netInclude := env("NET_INCLUDE", "")
+	netExclude := env("NET_EXCLUDE", collectors.DefaultNetExclude)
+	collectorList := env("COLLECTORS", "")
+	disableList := env("DISABLE_COLLECTORS", "")
+	intervalList := env("COLLECTOR_INTERVALS", "")
+	timeoutList := env("COLLECTOR_TIMEOUTS", "")
+	spoolDir := env("SPOOL_DIR", defaultSpoolDir())
+	spoolMaxMB := mustInt(env("SPOOL_MAX_MB", "64"), 64)
+	spoolMaxAge := mustDuration(env("SPOOL_MAX_AGE", "24h"), 24*time.Hour)
+	retryAttempts := int(mustInt(env("RETRY_ATTEMPTS", "3"), 3))
+	retryBase := mustDuration(env("RETRY_BASE", "500ms"), 500*time.Millisecond)
+	retryMax := mustDuration(env("RETRY_MAX", "10s"), 10*time.Second)
 
 	flag.StringVar(&server, "server", server, "server base URL")
 	flag.StringVar(&token, "token", token, "auth token")
@@ -33,6 +77,23 @@ func Load() Config {
 	flag.BoolVar(&once, "once", once, "collect once and exit")
 	flag.BoolVar(&printOnly, "print-only", printOnly, "print payload and do not send")
 	flag.StringVar(&lhmURL, "lhm-url", lhmURL, "LibreHardwareMonitor data.json URL")
+	flag.StringVar(&lhmInclude, "lhm-include", lhmInclude, "regexp of LHM sensor paths (hardware/group/sensor) to report")
+	flag.StringVar(&lhmExclude, "lhm-exclude", lhmExclude, "regexp of LHM sensor paths to skip")
+	flag.StringVar(&diskInclude, "disk-include", diskInclude, "regexp of mountpoints to report")
+	flag.StringVar(&diskExclude, "disk-exclude", diskExclude, "regexp of mountpoints to skip")
+	flag.StringVar(&diskExcludeFS, "disk-exclude-fstypes", diskExcludeFS, "comma separated filesystem types to skip")
+	flag.StringVar(&netInclude, "net-include", netInclude, "regexp of network interfaces to report")
+	flag.StringVar(&netExclude, "net-exclude", netExclude, "regexp of network interfaces to skip")
+	flag.StringVar(&collectorList, "collectors", collectorList, "comma separated collectors to enable (default all)")
+	flag.StringVar(&disableList, "disable-collectors", disableList, "comma separated collectors to disable")
+	flag.StringVar(&intervalList, "collector-intervals", intervalList, "per-collector intervals, e.g. nvidia=2s,cpu=5s")
+	flag.StringVar(&timeoutList, "collector-timeouts", timeoutList, "per-collector timeouts, e.g. nvidia=1s (default: the collector's interval)")
+	flag.StringVar(&spoolDir, "spool-dir", spoolDir, "directory for unsent payloads (empty disables spooling)")
+	flag.Int64Var(&spoolMaxMB, "spool-max-mb", spoolMaxMB, "maximum spool size in MB")
+	flag.DurationVar(&spoolMaxAge, "spool-max-age", spoolMaxAge, "drop spooled payloads older than this")
+	flag.IntVar(&retryAttempts, "retry-attempts", retryAttempts, "send attempts per payload before giving up")
+	flag.DurationVar(&retryBase, "retry-base", retryBase, "initial retry backoff")
+	flag.DurationVar(&retryMax, "retry-max", retryMax, "maximum retry backoff")
 	flag.Parse()
 
 	return Config{
@@ -43,6 +104,29 @@ func Load() Config {
 		Once:      once,
 		PrintOnly: printOnly,
 		LHMURL:    lhmURL,
+
+		LHMInclude: lhmInclude,
+		LHMExclude: lhmExclude,
+
+		DiskInclude:        diskInclude,
+		DiskExclude:        diskExclude,
+		DiskExcludeFSTypes: diskExcludeFS,
+
+		NetInclude: netInclude,
+		NetExclude: netExclude,
+
+		Collectors:         collectorList,
+		DisableCollectors:  disableList,
+		CollectorIntervals: intervalList,
+		CollectorTimeouts:  timeoutList,
+
+		SpoolDir:      spoolDir,
+		SpoolMaxBytes: spoolMaxMB << 20,
+		SpoolMaxAge:   spoolMaxAge,
+
+		RetryAttempts: retryAttempts,
+		RetryBase:     retryBase,
+		RetryMax:      retryMax,
 	}
 }
 
@@ -61,10 +145,26 @@ func host() string {
 	return name
 }
 
-func mustDuration(v string) time.Duration {
+func defaultSpoolDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, "home-telemetry", "spool")
+}
+
+func mustDuration(v string, def time.Duration) time.Duration {
 	d, err := time.ParseDuration(v)
 	if err != nil {
-		return 5 * time.Second
+		return def
 	}
 	return d
-}
\ No newline at end of file
+}
+
+func mustInt(v string, def int64) int64 {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -6,24 +6,63 @@ type IngestPayload struct {
 	NodeID    string            `json:"node_id"`
 	Timestamp string            `json:"timestamp"`
 	CPU       *CPUMetrics       `json:"cpu,omitempty"`
+	Mem       *MemMetrics       `json:"mem,omitempty"`
 	GPUs      []GPUMetrics      `json:"gpus,omitempty"`
+	Samples   []Sample          `json:"samples,omitempty"`
 	Tags      map[string]string `json:"tags,omitempty"`
 }
 
+// CPUMetrics and GPUMetrics use nil for values that were not measured so
+// they are not stored as zeros.
 type CPUMetrics struct {
-	TempC    float64 `json:"temp_c,omitempty"`
-	UsagePct float64 `json:"usage_pct"`
-	LoadAvg  float64 `json:"load_avg,omitempty"`
-	FreqMHz  float64 `json:"freq_mhz,omitempty"`
-	Cores    int     `json:"cores,omitempty"`
+	TempC    *float64 `json:"temp_c,omitempty"`
+	UsagePct *float64 `json:"usage_pct,omitempty"`
+	LoadAvg  *float64 `json:"load_avg,omitempty"`
+	FreqMHz  *float64 `json:"freq_mhz,omitempty"`
+	Cores    int      `json:"cores,omitempty"`
+}
+
+// MemMetrics is physical memory and swap usage in bytes.
+type MemMetrics struct {
+	TotalBytes     *float64 `json:"total_bytes,omitempty"`
+	UsedBytes      *float64 `json:"used_bytes,omitempty"`
+	AvailableBytes *float64 `json:"available_bytes,omitempty"`
+	CachedBytes    *float64 `json:"cached_bytes,omitempty"`
+	UsedPct        *float64 `json:"used_pct,omitempty"`
+	SwapTotalBytes *float64 `json:"swap_total_bytes,omitempty"`
+	SwapUsedBytes  *float64 `json:"swap_used_bytes,omitempty"`
+	SwapUsedPct    *float64 `json:"swap_used_pct,omitempty"`
+}
+
+// Sample is a free-form measurement for sources that have no dedicated
+// struct. Metric names are dotted like the built-in ones, e.g. "disk.used_bytes".
+type Sample struct {
+	Metric string            `json:"metric"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Unit   string            `json:"unit,omitempty"`
 }
 
 type GPUMetrics struct {
-	Name      string  `json:"name"`
-	TempC    float64 `json:"temp_c,omitempty"`
-	UsagePct  float64 `json:"usage_pct"`
-	MemUsedMB float64 `json:"mem_used_mb"`
-	PowerW    float64 `json:"power_w"`
+	Name      string   `json:"name"`
+	TempC     *float64 `json:"temp_c,omitempty"`
+	UsagePct  *float64 `json:"usage_pct,omitempty"`
+	MemUsedMB *float64 `json:"mem_used_mb,omitempty"`
+	PowerW    *float64 `json:"power_w,omitempty"`
+}
+
+// BatchResult mirrors the server's per-item report for a batch ingest.
+type BatchResult struct {
+	Accepted int               `json:"accepted"`
+	Failed   int               `json:"failed"`
+	Items    []BatchItemResult `json:"items"`
+}
+
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	NodeID string `json:"node_id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 func NewPayload(node string, cpu *CPUMetrics, gpus []GPUMetrics) IngestPayload {
@@ -33,4 +72,37 @@ func NewPayload(node string, cpu *CPUMetrics, gpus []GPUMetrics) IngestPayload {
 		CPU:       cpu,
 		GPUs:      gpus,
 	}
-}
\ No newline at end of file
+}
+
+// Merge copies the metrics carried by o into p.
+func (p *IngestPayload) Merge(o IngestPayload) {
+	if o.CPU != nil {
+		p.CPU = o.CPU
+	}
+	if o.Mem != nil {
+		p.Mem = o.Mem
+	}
+	p.GPUs = append(p.GPUs, o.GPUs...)
+	p.Samples = append(p.Samples, o.Samples...)
+	for k, v := range o.Tags {
+		if p.Tags == nil {
+			p.Tags = map[string]string{}
+		}
+		p.Tags[k] = v
+	}
+}
+
+// Empty reports whether p carries no metrics.
+func (p IngestPayload) Empty() bool {
+	return p.CPU == nil && p.Mem == nil && len(p.GPUs) == 0 && len(p.Samples) == 0
+}
+
+// AddSample appends a generic sample. labels may be nil.
+func (p *IngestPayload) AddSample(metric string, value float64, unit string, labels map[string]string) {
+	p.Samples = append(p.Samples, Sample{Metric: metric, Value: value, Unit: unit, Labels: labels})
+}
+
+// Float returns a pointer to v for the optional metric fields.
+func Float(v float64) *float64 {
+	return &v
+}
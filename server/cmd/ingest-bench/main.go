@@ -0,0 +1,178 @@
+// Command ingest-bench measures metric write throughput against a real
+// database. It compares the COPY based store.InsertIngest with the previous
+// one-INSERT-per-row pgx.Batch path:
+//
+//	go run ./cmd/ingest-bench -mode both
+//	go run ./cmd/ingest-bench -mode batch
+//	go run ./cmd/ingest-bench -mode copy
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"home-telemetry/server/internal/config"
+	"home-telemetry/server/internal/db"
+	"home-telemetry/server/internal/store"
+	"home-telemetry/server/internal/types"
+)
+
+func main() {
+	total := flag.Int("rows", 100000, "total rows to write")
+	perPayload := flag.Int("per-payload", 500, "rows per InsertIngest call")
+	mode := flag.String("mode", "both", "write path: copy (current), batch (per-row INSERT) or both")
+	node := flag.String("node", "ingest-bench", "node id to write under")
+	cleanup := flag.Bool("cleanup", true, "delete the benchmark rows afterwards")
+	flag.Parse()
+
+	cfg := config.LoadFromEnv()
+	logger := log.New(os.Stdout, "", log.LstdFlags|log.LUTC)
+	ctx := context.Background()
+
+	pool, err := db.Connect(ctx, cfg.DatabaseURL)
+	if err != nil {
+		logger.Fatalf("db connect: %v", err)
+	}
+	defer pool.Close()
+	stores := store.New(pool)
+
+	modes := []string{*mode}
+	if *mode == "both" {
+		modes = []string{"batch", "copy"}
+	}
+	results := map[string]float64{}
+	for _, m := range modes {
+		rate, err := run(ctx, pool, stores, m, *node, *total, *perPayload)
+		if err == nil && *cleanup {
+			err = cleanupNode(ctx, pool, *node)
+		}
+		if err != nil {
+			logger.Fatalf("%s: %v", m, err)
+		}
+		results[m] = rate
+		logger.Printf("mode=%s rows=%d per-payload=%d rows/sec=%.0f", m, *total, *perPayload, rate)
+	}
+	if len(results) == 2 {
+		logger.Printf("copy is %.1fx batch", results["copy"]/results["batch"])
+	}
+}
+
+// run writes total rows in payloads of perPayload through the given write
+// path and returns the rows written per second.
+func run(ctx context.Context, pool *pgxpool.Pool, stores store.Stores, mode, node string, total, perPayload int) (float64, error) {
+	labels := map[string]string{"gpu": "bench", "host": node}
+	var write func(ctx context.Context, ts time.Time, rows []types.MetricRow) error
+	switch mode {
+	case "copy":
+		write = func(ctx context.Context, ts time.Time, rows []types.MetricRow) error {
+			return stores.InsertIngest(ctx, node, ts, rows, nil)
+		}
+	case "batch":
+		// The old path wrote labels inline with every row. With the series
+		// catalog the closest equivalent is a plain INSERT per row with the
+		// series ids resolved once, outside the timed loop.
+		var warm []types.MetricRow
+		for i := 0; i < 8; i++ {
+			warm = append(warm, types.MetricRow{Time: time.Now().UTC(), Metric: fmt.Sprintf("bench.metric_%d", i), Labels: labels})
+		}
+		if err := stores.InsertIngest(ctx, node, time.Now().UTC(), warm, nil); err != nil {
+			return 0, fmt.Errorf("warm up: %w", err)
+		}
+		ids, err := seriesIDs(ctx, pool, node)
+		if err != nil {
+			return 0, err
+		}
+		write = func(ctx context.Context, ts time.Time, rows []types.MetricRow) error {
+			return insertBatch(ctx, pool, node, ts, rows, ids)
+		}
+	default:
+		return 0, fmt.Errorf("unknown mode %q", mode)
+	}
+
+	base := time.Now().UTC().Add(-time.Duration(total) * time.Second)
+	written := 0
+	start := time.Now()
+	for written < total {
+		n := min(perPayload, total-written)
+		rows := make([]types.MetricRow, n)
+		for i := range rows {
+			rows[i] = types.MetricRow{
+				Time:   base.Add(time.Duration(written+i) * time.Second),
+				Metric: fmt.Sprintf("bench.metric_%d", i%8),
+				Value:  float64(i),
+				Labels: labels,
+			}
+		}
+		if err := write(ctx, rows[n-1].Time, rows); err != nil {
+			return 0, fmt.Errorf("write: %w", err)
+		}
+		written += n
+	}
+	return float64(written) / time.Since(start).Seconds(), nil
+}
+
+func cleanupNode(ctx context.Context, pool *pgxpool.Pool, node string) error {
+	for _, q := range []string{
+		"DELETE FROM metrics WHERE series_id IN (SELECT id FROM series WHERE node_id = $1)",
+		"DELETE FROM series WHERE node_id = $1",
+		"DELETE FROM nodes WHERE id = $1",
+	} {
+		if _, err := pool.Exec(ctx, q, node); err != nil {
+			return fmt.Errorf("cleanup: %w", err)
+		}
+	}
+	return nil
+}
+
+// seriesIDs maps the benchmark metrics of node to their series ids. All
+// benchmark rows share one label set.
+func seriesIDs(ctx context.Context, pool *pgxpool.Pool, node string) (map[string]int64, error) {
+	rows, err := pool.Query(ctx, "SELECT metric, id FROM series WHERE node_id = $1", node)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[string]int64{}
+	for rows.Next() {
+		var metric string
+		var id int64
+		if err := rows.Scan(&metric, &id); err != nil {
+			return nil, err
+		}
+		ids[metric] = id
+	}
+	return ids, rows.Err()
+}
+
+// insertBatch is the write path InsertIngest used before COPY: a node
+// upsert and one queued INSERT per row in a single pgx.Batch.
+func insertBatch(ctx context.Context, pool *pgxpool.Pool, nodeID string, ts time.Time, metrics []types.MetricRow, ids map[string]int64) error {
+	batch := &pgx.Batch{}
+	batch.Queue(
+		"INSERT INTO nodes (id, name, last_seen, meta) VALUES ($1, $2, $3, $4) "+
+			"ON CONFLICT (id) DO UPDATE SET last_seen = EXCLUDED.last_seen, meta = EXCLUDED.meta",
+		nodeID, nodeID, ts, []byte("{}"),
+	)
+	for _, m := range metrics {
+		batch.Queue(
+			"INSERT INTO metrics (time, series_id, value) VALUES ($1, $2, $3)",
+			m.Time, ids[m.Metric], m.Value,
+		)
+	}
+
+	br := pool.SendBatch(ctx, batch)
+	defer br.Close()
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := br.Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
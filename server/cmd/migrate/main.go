@@ -0,0 +1,85 @@
+// Command migrate applies the SQL migrations in server/migrations.
+//
+//	migrate status           list migrations and whether they are applied
+//	migrate up               apply all pending migrations (the default)
+//	migrate down-to VERSION  revert migrations newer than VERSION (0 reverts all)
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"home-telemetry/server/internal/config"
+	"home-telemetry/server/internal/db"
+	"home-telemetry/server/internal/migrate"
+	"home-telemetry/server/migrations"
+)
+
+func main() {
+	cfg := config.LoadFromEnv()
+	logger := log.New(os.Stdout, "", log.LstdFlags|log.LUTC)
+
+	cmd := "up"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		logger.Fatalf("load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	pool, err := db.Connect(ctx, cfg.DatabaseURL)
+	if err != nil {
+		logger.Fatalf("db connect: %v", err)
+	}
+	defer pool.Close()
+	runner := migrate.New(pool, all)
+
+	switch cmd {
+	case "status":
+		status, err := runner.Status(ctx)
+		if err != nil {
+			logger.Fatalf("status: %v", err)
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%03d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, m := range applied {
+			logger.Printf("applied %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Fatalf("up: %v", err)
+		}
+		if len(applied) == 0 {
+			logger.Printf("schema is up to date")
+		}
+	case "down-to":
+		if len(os.Args) < 3 {
+			logger.Fatalf("usage: migrate down-to VERSION")
+		}
+		target, err := strconv.Atoi(os.Args[2])
+		if err != nil || target < 0 {
+			logger.Fatalf("invalid version %q", os.Args[2])
+		}
+		reverted, err := runner.DownTo(ctx, target)
+		for _, m := range reverted {
+			logger.Printf("reverted %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Fatalf("down-to: %v", err)
+		}
+	default:
+		logger.Fatalf("unknown command %q (want status, up or down-to)", cmd)
+	}
+}
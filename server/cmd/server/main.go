@@ -18,7 +18,12 @@ import (
 	"home-telemetry/server/internal/api"
 	"home-telemetry/server/internal/config"
 	"home-telemetry/server/internal/db"
+	"home-telemetry/server/internal/ingest"
+	"home-telemetry/server/internal/migrate"
+	"home-telemetry/server/internal/mqttbridge"
+	"home-telemetry/server/internal/statsd"
 	"home-telemetry/server/internal/store"
+	"home-telemetry/server/migrations"
 
 	_ "home-telemetry/server/docs"
 )
@@ -36,8 +41,51 @@ func main() {
 	}
 	defer pool.Close()
 
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		logger.Fatalf("load migrations: %v", err)
+	}
+	runner := migrate.New(pool, all)
+	if cfg.AutoMigrate {
+		applied, err := runner.Up(context.Background())
+		for _, m := range applied {
+			logger.Printf("applied migration %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			logger.Fatalf("migrate: %v", err)
+		}
+	}
+	if err := runner.Check(ctx); err != nil {
+		logger.Fatalf("%v (run `go run ./cmd/migrate up` or set AUTO_MIGRATE=true)", err)
+	}
+
 	stores := store.New(pool)
 	h := api.NewHandler(cfg, stores, logger)
+	if cfg.HooksConfig != "" {
+		hooks, err := ingest.LoadHooks(cfg.HooksConfig)
+		if err != nil {
+			logger.Fatalf("hooks config: %v", err)
+		}
+		h.SetHooks(hooks)
+	}
+
+	if cfg.StatsDAddr != "" {
+		sd, err := statsd.Listen(cfg.StatsDAddr, cfg.StatsDNodeID, cfg.StatsDFlushInterval, stores, logger)
+		if err != nil {
+			logger.Fatalf("statsd listen: %v", err)
+		}
+		logger.Printf("statsd listening on %s (node %s, flush %s)", sd.Addr(), cfg.StatsDNodeID, cfg.StatsDFlushInterval)
+		go sd.Serve(context.Background())
+	}
+
+	if cfg.MQTTConfig != "" {
+		mqttCfg, err := mqttbridge.LoadConfig(cfg.MQTTConfig)
+		if err != nil {
+			logger.Fatalf("mqtt config: %v", err)
+		}
+		logger.Printf("mqtt bridge: %s, %d subscriptions", mqttCfg.Broker, len(mqttCfg.Subscriptions))
+		go mqttbridge.New(mqttCfg, stores, logger).Run(context.Background())
+	}
 
 	srv := &http.Server{
 		Addr:              cfg.HTTPAddr,
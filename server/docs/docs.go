@@ -15,6 +15,88 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/hooks/{name}": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Maps an arbitrary JSON body (object, or array of objects) to metrics using the hook's configured mapping. Mapping templates can use {hook} and any query parameter, e.g. {node} for ?node=kitchen. For devices that cannot set headers the token may be passed as the token parameter.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ingest"
+                ],
+                "summary": "Generic JSON webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Hook name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ingest token, instead of the Authorization header",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
         "/ingest": {
             "post": {
                 "security": [
@@ -22,31 +104,451 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Accepts a single metrics payload.",
+                "description": "Accepts a single metrics payload.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ingest"
+                ],
+                "summary": "Ingest metrics",
+                "parameters": [
+                    {
+                        "description": "Ingest payload",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/home-telemetry_server_internal_types.IngestPayload"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/ingest/batch": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Accepts a JSON array of payloads, or newline delimited JSON when Content-Type is application/x-ndjson. Payloads may come from different nodes. Each item is stored independently and reported in the response.",
+                "consumes": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ingest"
+                ],
+                "summary": "Ingest a batch of metrics payloads",
+                "parameters": [
+                    {
+                        "description": "Ingest payloads",
+                        "name": "payload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/home-telemetry_server_internal_types.IngestPayload"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "All items accepted",
+                        "schema": {
+                            "$ref": "#/definitions/home-telemetry_server_internal_types.BatchResult"
+                        }
+                    },
+                    "207": {
+                        "description": "Some items failed",
+                        "schema": {
+                            "$ref": "#/definitions/home-telemetry_server_internal_types.BatchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/label/{name}/values": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "prometheus"
+                ],
+                "summary": "Prometheus label values",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Label name; __name__ lists metric names",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/labels": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "prometheus"
+                ],
+                "summary": "Prometheus label names",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Query metrics",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Node ID; repeat or comma separate for several. Omit to query every node.",
+                        "name": "node_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Regex over node IDs",
+                        "name": "node_match",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "metric",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 time",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Max raw rows (default 1000, at most 10000); not used with step",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bucket width, e.g. 1m or 300 (seconds). Returns one point per bucket per series. Requires from; at most 11000 buckets.",
+                        "name": "step",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bucket aggregation when step is set: avg (default), min, max, last, sum, p95",
+                        "name": "agg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Label matcher: name=value, name!=value, name=~regex or name!~regex",
+                        "name": "match",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated labels, including node; merges series sharing their values (requires step)",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "How grouped series are combined per bucket: avg (default), min, max, sum. Without group_by, all matching series are combined into one.",
+                        "name": "group_agg",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "array",
+                                "items": {
+                                    "$ref": "#/definitions/home-telemetry_server_internal_types.Series"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/nodes": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "nodes"
+                ],
+                "summary": "List nodes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/home-telemetry_server_internal_store.Node"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/otlp/v1/metrics": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Accepts OTLP ExportMetricsServiceRequests as protobuf (application/x-protobuf) or JSON (application/json), optionally gzip encoded. Set OTEL_EXPORTER_OTLP_ENDPOINT to https://host:8443/api/v1/otlp. The node is the host.name resource attribute, or service.name.",
+                "consumes": [
+                    "application/x-protobuf",
+                    "application/json"
+                ],
+                "tags": [
+                    "ingest"
+                ],
+                "summary": "OTLP/HTTP metrics receiver",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/prom/write": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Accepts snappy compressed protobuf WriteRequests (remote_write 1.0). The metric is __name__, the node is the instance host without port (or job), and the other labels except instance are stored as labels. Point Prometheus at it with remote_write url https://host:8443/api/v1/prom/write and authorization credentials set to the ingest token.",
                 "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
+                    "application/x-protobuf"
                 ],
                 "tags": [
                     "ingest"
                 ],
-                "summary": "Ingest metrics",
-                "parameters": [
-                    {
-                        "description": "Ingest payload",
-                        "name": "payload",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/home-telemetry_server_internal_types.IngestPayload"
-                        }
-                    }
-                ],
+                "summary": "Prometheus remote_write receiver",
                 "responses": {
-                    "202": {
-                        "description": "Accepted",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -54,8 +556,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -63,8 +565,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -84,51 +586,85 @@ const docTemplate = `{
                 }
             }
         },
-        "/metrics": {
+        "/query": {
             "get": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "metrics"
+                    "prometheus"
                 ],
-                "summary": "Query metrics",
+                "summary": "Prometheus instant query",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Node ID",
-                        "name": "node_id",
+                        "description": "PromQL expression",
+                        "name": "query",
                         "in": "query",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Metric name",
-                        "name": "metric",
+                        "description": "RFC3339 or unix seconds; defaults to now",
+                        "name": "time",
                         "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/query_range": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "prometheus"
+                ],
+                "summary": "Prometheus range query",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "RFC3339 time",
-                        "name": "from",
-                        "in": "query"
+                        "description": "PromQL expression",
+                        "name": "query",
+                        "in": "query",
+                        "required": true
                     },
                     {
                         "type": "string",
-                        "description": "RFC3339 time",
-                        "name": "to",
-                        "in": "query"
+                        "description": "RFC3339 or unix seconds",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Max rows (default 1000)",
-                        "name": "limit",
-                        "in": "query"
+                        "type": "string",
+                        "description": "RFC3339 or unix seconds",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Duration such as 30s, or seconds",
+                        "name": "step",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -136,56 +672,98 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "array",
-                                "items": {
-                                    "$ref": "#/definitions/home-telemetry_server_internal_types.MetricRow"
-                                }
-                            }
+                            "additionalProperties": true
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/series": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "prometheus"
+                ],
+                "summary": "Prometheus series lookup",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Series selector, e.g. cpu_temp_c{node=\\",
+                        "name": "match[]",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "additionalProperties": true
                         }
                     }
                 }
             }
         },
-        "/nodes": {
-            "get": {
+        "/write": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "produces": [
-                    "application/json"
+                "description": "Accepts InfluxDB line protocol, optionally gzip encoded. Each numeric or boolean field is stored as measurement.field (just measurement for a field named value); the node comes from the tag set by INFLUX_NODE_TAG (default host), or the node parameter for lines without it. Other tags become labels. Credentials may be sent as Bearer or Token authorization, basic auth password or p parameter.",
+                "consumes": [
+                    "text/plain"
                 ],
                 "tags": [
-                    "nodes"
+                    "ingest"
+                ],
+                "summary": "InfluxDB line protocol write",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Timestamp unit: ns (default), us, ms, s",
+                        "name": "precision",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Node id for lines without the node tag",
+                        "name": "node",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List nodes",
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/home-telemetry_server_internal_store.Node"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     },
@@ -198,6 +776,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -232,6 +819,40 @@ const docTemplate = `{
                 }
             }
         },
+        "home-telemetry_server_internal_types.BatchItemResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "node_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "home-telemetry_server_internal_types.BatchResult": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/home-telemetry_server_internal_types.BatchItemResult"
+                    }
+                }
+            }
+        },
         "home-telemetry_server_internal_types.CPUMetrics": {
             "type": "object",
             "properties": {
@@ -284,9 +905,18 @@ const docTemplate = `{
                         "$ref": "#/definitions/home-telemetry_server_internal_types.GPUMetrics"
                     }
                 },
+                "mem": {
+                    "$ref": "#/definitions/home-telemetry_server_internal_types.MemMetrics"
+                },
                 "node_id": {
                     "type": "string"
                 },
+                "samples": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/home-telemetry_server_internal_types.Sample"
+                    }
+                },
                 "tags": {
                     "type": "object",
                     "additionalProperties": {
@@ -298,7 +928,47 @@ const docTemplate = `{
                 }
             }
         },
-        "home-telemetry_server_internal_types.MetricRow": {
+        "home-telemetry_server_internal_types.MemMetrics": {
+            "type": "object",
+            "properties": {
+                "available_bytes": {
+                    "type": "number"
+                },
+                "cached_bytes": {
+                    "type": "number"
+                },
+                "swap_total_bytes": {
+                    "type": "number"
+                },
+                "swap_used_bytes": {
+                    "type": "number"
+                },
+                "swap_used_pct": {
+                    "type": "number"
+                },
+                "total_bytes": {
+                    "type": "number"
+                },
+                "used_bytes": {
+                    "type": "number"
+                },
+                "used_pct": {
+                    "type": "number"
+                }
+            }
+        },
+        "home-telemetry_server_internal_types.Point": {
+            "type": "object",
+            "properties": {
+                "time": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "home-telemetry_server_internal_types.Sample": {
             "type": "object",
             "properties": {
                 "labels": {
@@ -310,13 +980,33 @@ const docTemplate = `{
                 "metric": {
                     "type": "string"
                 },
-                "time": {
+                "unit": {
                     "type": "string"
                 },
                 "value": {
                     "type": "number"
                 }
             }
+        },
+        "home-telemetry_server_internal_types.Series": {
+            "type": "object",
+            "properties": {
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "metric": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/home-telemetry_server_internal_types.Point"
+                    }
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -1,7 +1,11 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -13,6 +17,8 @@ import (
 
 	"home-telemetry/server/internal/auth"
 	"home-telemetry/server/internal/config"
+	"home-telemetry/server/internal/ingest"
+	"home-telemetry/server/internal/promql"
 	"home-telemetry/server/internal/store"
 	"home-telemetry/server/internal/types"
 )
@@ -20,11 +26,14 @@ import (
 type Handler struct {
 	cfg    config.Config
 	stores store.Stores
+	engine *promql.Engine
+	deltas *ingest.Deltas
+	hooks  ingest.Hooks
 	logger *log.Logger
 }
 
 func NewHandler(cfg config.Config, stores store.Stores, logger *log.Logger) *Handler {
-	return &Handler{cfg: cfg, stores: stores, logger: logger}
+	return &Handler{cfg: cfg, stores: stores, engine: promql.NewEngine(stores), deltas: ingest.NewDeltas(), logger: logger}
 }
 
 func (h *Handler) Routes() http.Handler {
@@ -44,8 +53,26 @@ func (h *Handler) Routes() http.Handler {
 		r.Get("/nodes", h.handleNodes)
 		r.Get("/metrics", h.handleMetrics)
 
+		// Prometheus HTTP API subset for Grafana
+		r.Get("/query", h.handlePromQuery)
+		r.Post("/query", h.handlePromQuery)
+		r.Get("/query_range", h.handlePromQueryRange)
+		r.Post("/query_range", h.handlePromQueryRange)
+		r.Get("/labels", h.handlePromLabels)
+		r.Post("/labels", h.handlePromLabels)
+		r.Get("/label/{name}/values", h.handlePromLabelValues)
+		r.Get("/series", h.handlePromSeries)
+		r.Post("/series", h.handlePromSeries)
+		r.Get("/metadata", h.handlePromMetadata)
+		r.Get("/status/buildinfo", h.handlePromBuildInfo)
+
 		// Protected ingest endpoint
 		r.With(auth.TokenMiddleware(h.cfg.AuthToken)).Post("/ingest", h.handleIngest)
+		r.With(auth.TokenMiddleware(h.cfg.AuthToken)).Post("/ingest/batch", h.handleIngestBatch)
+		r.With(auth.TokenMiddleware(h.cfg.AuthToken)).Post("/prom/write", h.handleRemoteWrite)
+		r.With(auth.InfluxTokenMiddleware(h.cfg.AuthToken)).Post("/write", h.handleInfluxWrite)
+		r.With(auth.TokenMiddleware(h.cfg.AuthToken)).Post("/otlp/v1/metrics", h.handleOTLPMetrics)
+		r.With(auth.QueryTokenMiddleware(h.cfg.AuthToken, "token")).Post("/hooks/{name}", h.handleHook)
 	})
 	return r
 }
@@ -107,29 +134,120 @@ func (h *Handler) handleIngest(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+
+	status, err := h.ingest(r.Context(), payload)
+	if err != nil && status == http.StatusInternalServerError {
+		h.logger.Printf("ingest error: %v", err)
+	}
+	w.WriteHeader(status)
+}
+
+// ingest validates and stores one payload, returning the HTTP status that
+// describes the outcome.
+func (h *Handler) ingest(ctx context.Context, payload types.IngestPayload) (int, error) {
 	if payload.NodeID == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+		return http.StatusBadRequest, errors.New("node_id required")
 	}
 
 	ts := time.Now().UTC()
 	if payload.Timestamp != "" {
 		parsed, err := time.Parse(time.RFC3339, payload.Timestamp)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			return http.StatusBadRequest, fmt.Errorf("invalid timestamp: %w", err)
 		}
 		ts = parsed.UTC()
 	}
 
 	metrics := types.ToMetricRows(payload, ts)
-	if err := h.stores.InsertIngest(r.Context(), payload.NodeID, ts, metrics, payload.Tags); err != nil {
-		h.logger.Printf("ingest error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := h.stores.InsertIngest(ctx, payload.NodeID, ts, metrics, payload.Tags); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusAccepted, nil
+}
+
+const maxBatchItems = 5000
+
+// @Summary Ingest a batch of metrics payloads
+// @Description Accepts a JSON array of payloads, or newline delimited JSON when Content-Type is application/x-ndjson. Payloads may come from different nodes. Each item is stored independently and reported in the response.
+// @Tags ingest
+// @Accept json
+// @Accept application/x-ndjson
+// @Produce json
+// @Param payload body []types.IngestPayload true "Ingest payloads"
+// @Success 202 {object} types.BatchResult "All items accepted"
+// @Success 207 {object} types.BatchResult "Some items failed"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Security BearerAuth
+// @Router /ingest/batch [post]
+func (h *Handler) handleIngestBatch(w http.ResponseWriter, r *http.Request) {
+	payloads, err := decodeBatch(r)
+	if err != nil {
+		if errors.Is(err, errBatchTooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	result := types.BatchResult{Items: make([]types.BatchItemResult, 0, len(payloads))}
+	for i, p := range payloads {
+		item := types.BatchItemResult{Index: i, NodeID: p.NodeID, Status: http.StatusAccepted}
+		status, err := h.ingest(r.Context(), p)
+		if err != nil {
+			item.Status = status
+			item.Error = err.Error()
+			if status == http.StatusInternalServerError {
+				h.logger.Printf("batch ingest error: node=%s item=%d: %v", p.NodeID, i, err)
+				item.Error = "storage error"
+			}
+			result.Failed++
+		} else {
+			result.Accepted++
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	status := http.StatusAccepted
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var errBatchTooLarge = fmt.Errorf("batch exceeds %d items", maxBatchItems)
+
+func decodeBatch(r *http.Request) ([]types.IngestPayload, error) {
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "application/x-ndjson") || strings.HasPrefix(ct, "application/jsonl") {
+		var out []types.IngestPayload
+		dec := json.NewDecoder(r.Body)
+		for {
+			var p types.IngestPayload
+			if err := dec.Decode(&p); err == io.EOF {
+				return out, nil
+			} else if err != nil {
+				return nil, err
+			}
+			if len(out) == maxBatchItems {
+				return nil, errBatchTooLarge
+			}
+			out = append(out, p)
+		}
+	}
+
+	var out []types.IngestPayload
+	if err := json.NewDecoder(r.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out) > maxBatchItems {
+		return nil, errBatchTooLarge
+	}
+	return out, nil
 }
 
 // @Summary List nodes
@@ -154,23 +272,40 @@ func (h *Handler) handleNodes(w http.ResponseWriter, r *http.Request) {
 // @Summary Query metrics
 // @Tags metrics
 // @Produce json
-// @Param node_id query string true "Node ID"
+// @Param node_id query []string false "Node ID; repeat or comma separate for several. Omit to query every node." collectionFormat(multi)
+// @Param node_match query string false "Regex over node IDs"
 // @Param metric query string false "Metric name"
 // @Param from query string false "RFC3339 time"
 // @Param to query string false "RFC3339 time"
-// @Param limit query int false "Max rows (default 1000)"
-// @Success 200 {object} map[string][]types.MetricRow
+// @Param limit query int false "Max raw rows (default 1000, at most 10000); not used with step"
+// @Param step query string false "Bucket width, e.g. 1m or 300 (seconds). Returns one point per bucket per series. Requires from; at most 11000 buckets."
+// @Param agg query string false "Bucket aggregation when step is set: avg (default), min, max, last, sum, p95"
+// @Param match query []string false "Label matcher: name=value, name!=value, name=~regex or name!~regex" collectionFormat(multi)
+// @Param group_by query string false "Comma separated labels, including node; merges series sharing their values (requires step)"
+// @Param group_agg query string false "How grouped series are combined per bucket: avg (default), min, max, sum. Without group_by, all matching series are combined into one."
+// @Success 200 {object} map[string][]types.Series
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Security BearerAuth
 // @Router /metrics [get]
 func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
-	nodeID := q.Get("node_id")
+	var nodeIDs []string
+	for _, v := range q["node_id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" && id != "*" {
+				nodeIDs = append(nodeIDs, id)
+			}
+		}
+	}
+	nodePattern := q.Get("node_match")
 	metric := q.Get("metric")
 	fromStr := q.Get("from")
 	toStr := q.Get("to")
 	limitStr := q.Get("limit")
+	stepStr := q.Get("step")
+	agg := q.Get("agg")
+	groupAgg := q.Get("group_agg")
 
 	var from *time.Time
 	if fromStr != "" {
@@ -200,12 +335,61 @@ func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rows, err := h.stores.QueryMetrics(r.Context(), store.MetricsQuery{
-		NodeID: nodeID,
-		Metric: metric,
-		From:   from,
-		To:     to,
-		Limit:  limit,
+	var step time.Duration
+	if stepStr != "" {
+		parsed, err := parseStep(stepStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		step = parsed
+	}
+	if agg != "" {
+		if _, ok := store.Aggregations[agg]; !ok || step == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var matchers []store.LabelMatcher
+	for _, raw := range q["match"] {
+		m, err := store.ParseLabelMatcher(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		matchers = append(matchers, m)
+	}
+
+	var groupBy []string
+	for _, name := range strings.Split(q.Get("group_by"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			groupBy = append(groupBy, name)
+		}
+	}
+	if len(groupBy) > 0 && step == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if groupAgg != "" {
+		if _, ok := store.GroupAggregations[groupAgg]; !ok || step == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	series, err := h.stores.QueryMetrics(r.Context(), store.MetricsQuery{
+		NodeIDs:     nodeIDs,
+		NodePattern: nodePattern,
+		Metric:      metric,
+		From:        from,
+		To:          to,
+		Limit:       limit,
+		Step:        step,
+		Agg:         agg,
+		Matchers:    matchers,
+		GroupBy:     groupBy,
+		GroupAgg:    groupAgg,
 	})
 	if err != nil {
 		h.logger.Printf("metrics error: %v", err)
@@ -214,5 +398,21 @@ func (h *Handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]any{"series": rows})
-}
+	_ = json.NewEncoder(w).Encode(map[string]any{"series": series})
+}
+
+// parseStep accepts a Go duration ("1m", "90s") or a number of seconds.
+func parseStep(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, serr := strconv.ParseFloat(v, 64)
+		if serr != nil {
+			return 0, err
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("step must be at least 1s")
+	}
+	return d, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"home-telemetry/server/internal/ingest"
+	"home-telemetry/server/internal/types"
+)
+
+const maxHookBody = 1 << 20
+
+// SetHooks installs the webhook mappings served under /hooks/{name}.
+func (h *Handler) SetHooks(hooks ingest.Hooks) {
+	h.hooks = hooks
+}
+
+// @Summary Generic JSON webhook
+// @Description Maps an arbitrary JSON body (object, or array of objects) to metrics using the hook's configured mapping. Mapping templates can use {hook} and any query parameter, e.g. {node} for ?node=kitchen. For devices that cannot set headers the token may be passed as the token parameter.
+// @Tags ingest
+// @Accept json
+// @Param name path string true "Hook name"
+// @Param token query string false "Ingest token, instead of the Authorization header"
+// @Success 202
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /hooks/{name} [post]
+func (h *Handler) handleHook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	mapping, ok := h.hooks[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxHookBody {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := map[string]string{}
+	for k, v := range r.URL.Query() {
+		if k != "token" && len(v) > 0 {
+			vars[k] = v[0]
+		}
+	}
+	vars["hook"] = name
+
+	docs := []any{doc}
+	if arr, ok := doc.([]any); ok {
+		docs = arr
+	}
+	now := time.Now()
+	var nodes []string
+	rows := map[string][]types.MetricRow{}
+	for _, d := range docs {
+		nodeID, mapped, err := mapping.Rows(d, vars, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := rows[nodeID]; !ok {
+			nodes = append(nodes, nodeID)
+		}
+		rows[nodeID] = append(rows[nodeID], mapped...)
+	}
+
+	if err := h.stores.InsertRows(r.Context(), nodes, rows); err != nil {
+		h.logger.Printf("hook %s error: %v", name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+
+	"home-telemetry/server/internal/ingest"
+)
+
+const maxWriteBody = 32 << 20
+
+// @Summary InfluxDB line protocol write
+// @Description Accepts InfluxDB line protocol, optionally gzip encoded. Each numeric or boolean field is stored as measurement.field (just measurement for a field named value); the node comes from the tag set by INFLUX_NODE_TAG (default host), or the node parameter for lines without it. Other tags become labels. Credentials may be sent as Bearer or Token authorization, basic auth password or p parameter.
+// @Tags ingest
+// @Accept plain
+// @Param precision query string false "Timestamp unit: ns (default), us, ms, s"
+// @Param node query string false "Node id for lines without the node tag"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /write [post]
+func (h *Handler) handleInfluxWrite(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	precision, err := ingest.ParsePrecision(q.Get("precision"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var src io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		src = gz
+	}
+	body, err := io.ReadAll(io.LimitReader(src, maxWriteBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWriteBody {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rows, _, err := ingest.LineProtocol(body, ingest.LineOptions{
+		NodeTag:     h.cfg.InfluxNodeTag,
+		DefaultNode: q.Get("node"),
+		Precision:   precision,
+		Now:         time.Now(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.stores.InsertRows(r.Context(), rows.Nodes, rows.Rows); err != nil {
+		h.logger.Printf("influx write error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"home-telemetry/server/internal/ingest"
+)
+
+// @Summary OTLP/HTTP metrics receiver
+// @Description Accepts OTLP ExportMetricsServiceRequests as protobuf (application/x-protobuf) or JSON (application/json), optionally gzip encoded. Set OTEL_EXPORTER_OTLP_ENDPOINT to https://host:8443/api/v1/otlp. The node is the host.name resource attribute, or service.name.
+// @Tags ingest
+// @Accept application/x-protobuf
+// @Accept json
+// @Success 200
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security BearerAuth
+// @Router /otlp/v1/metrics [post]
+func (h *Handler) handleOTLPMetrics(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var isJSON bool
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf":
+	case "application/json":
+		isJSON = true
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var src io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		src = gz
+	}
+	body, err := io.ReadAll(io.LimitReader(src, maxWriteBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWriteBody {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	req, err := ingest.DecodeOTLP(body, isJSON)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	deltas := h.deltas.Batch(now)
+	rows, rejected := ingest.OTLP(req, deltas, now)
+
+	if err := h.stores.InsertRows(r.Context(), rows.Nodes, rows.Rows); err != nil {
+		h.logger.Printf("otlp error: %v", err)
+		// 503 is retryable for OTLP exporters; 500 is not. The exporter
+		// resends the same deltas, so they are taken back out.
+		deltas.Rollback()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var message string
+	if rejected > 0 {
+		message = fmt.Sprintf("%d data points without a host.name or service.name resource attribute, metric name or value were dropped", rejected)
+	}
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(ingest.OTLPResponse(rejected, message, isJSON))
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"home-telemetry/server/internal/promql"
+)
+
+// The handlers in this file implement the subset of the Prometheus HTTP API
+// that Grafana's Prometheus data source needs, so the server can be added
+// as a data source at https://host:8443. Responses use the Prometheus
+// envelope rather than the plain status codes of the other endpoints.
+
+type promResponse struct {
+	Status    string `json:"status"`
+	Data      any    `json:"data,omitempty"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type promQueryData struct {
+	ResultType string `json:"resultType"`
+	Result     any    `json:"result"`
+}
+
+type promSeries struct {
+	Metric promql.Labels `json:"metric"`
+	Value  []any         `json:"value,omitempty"`
+	Values [][]any       `json:"values,omitempty"`
+}
+
+func writeProm(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(promResponse{Status: "success", Data: data})
+}
+
+func (h *Handler) writePromError(w http.ResponseWriter, err error) {
+	status, errType := http.StatusBadRequest, "bad_data"
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		status, errType = http.StatusServiceUnavailable, "timeout"
+	case errors.Is(err, errPromBadParam), errors.Is(err, promql.ErrBadQuery):
+	default:
+		h.logger.Printf("prom query error: %v", err)
+		status, errType = http.StatusInternalServerError, "internal"
+		err = errors.New("storage error")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(promResponse{Status: "error", ErrorType: errType, Error: err.Error()})
+}
+
+var errPromBadParam = errors.New("invalid parameter")
+
+// @Summary Prometheus instant query
+// @Tags prometheus
+// @Produce json
+// @Param query query string true "PromQL expression"
+// @Param time query string false "RFC3339 or unix seconds; defaults to now"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Router /query [get]
+func (h *Handler) handlePromQuery(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writePromError(w, fmt.Errorf("%w: %v", errPromBadParam, err))
+		return
+	}
+	expr, err := promql.Parse(r.Form.Get("query"))
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	ts := time.Now()
+	if v := r.Form.Get("time"); v != "" {
+		if ts, err = parsePromTime(v); err != nil {
+			h.writePromError(w, err)
+			return
+		}
+	}
+
+	value, err := h.engine.Instant(r.Context(), expr, ts)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	writeProm(w, promQueryData{ResultType: value.Type(), Result: promResult(value)})
+}
+
+// @Summary Prometheus range query
+// @Tags prometheus
+// @Produce json
+// @Param query query string true "PromQL expression"
+// @Param start query string true "RFC3339 or unix seconds"
+// @Param end query string true "RFC3339 or unix seconds"
+// @Param step query string true "Duration such as 30s, or seconds"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Router /query_range [get]
+func (h *Handler) handlePromQueryRange(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writePromError(w, fmt.Errorf("%w: %v", errPromBadParam, err))
+		return
+	}
+	expr, err := promql.Parse(r.Form.Get("query"))
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	start, err := parsePromTime(r.Form.Get("start"))
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	end, err := parsePromTime(r.Form.Get("end"))
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	step, err := parsePromDuration(r.Form.Get("step"))
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+
+	matrix, err := h.engine.Range(r.Context(), expr, start, end, step)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	writeProm(w, promQueryData{ResultType: matrix.Type(), Result: promResult(matrix)})
+}
+
+// @Summary Prometheus label names
+// @Tags prometheus
+// @Produce json
+// @Success 200 {object} map[string]any
+// @Router /labels [get]
+func (h *Handler) handlePromLabels(w http.ResponseWriter, r *http.Request) {
+	names, err := h.stores.LabelNames(r.Context())
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	out := []string{"__name__"}
+	seen := map[string]bool{"__name__": true}
+	for _, n := range names {
+		if n = promql.PromName(n); !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	writeProm(w, out)
+}
+
+// @Summary Prometheus label values
+// @Tags prometheus
+// @Produce json
+// @Param name path string true "Label name; __name__ lists metric names"
+// @Success 200 {object} map[string]any
+// @Router /label/{name}/values [get]
+func (h *Handler) handlePromLabelValues(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	ctx := r.Context()
+
+	var stored []string
+	if name == "__name__" {
+		metrics, err := h.stores.MetricNames(ctx)
+		if err != nil {
+			h.writePromError(w, err)
+			return
+		}
+		for _, m := range metrics {
+			stored = append(stored, promql.PromName(m))
+		}
+	} else {
+		// Several stored label names can map onto the same Prometheus name.
+		labels, err := h.stores.LabelNames(ctx)
+		if err != nil {
+			h.writePromError(w, err)
+			return
+		}
+		for _, l := range labels {
+			if promql.PromName(l) != name {
+				continue
+			}
+			values, err := h.stores.LabelValues(ctx, l)
+			if err != nil {
+				h.writePromError(w, err)
+				return
+			}
+			stored = append(stored, values...)
+		}
+	}
+
+	out := []string{}
+	seen := map[string]bool{}
+	for _, v := range stored {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	writeProm(w, out)
+}
+
+// @Summary Prometheus series lookup
+// @Tags prometheus
+// @Produce json
+// @Param match[] query []string true "Series selector, e.g. cpu_temp_c{node=\"pc1\"}" collectionFormat(multi)
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Router /series [get]
+func (h *Handler) handlePromSeries(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writePromError(w, fmt.Errorf("%w: %v", errPromBadParam, err))
+		return
+	}
+	selectors := r.Form["match[]"]
+	if len(selectors) == 0 {
+		h.writePromError(w, fmt.Errorf("%w: no match[] parameter provided", errPromBadParam))
+		return
+	}
+
+	out := []promql.Labels{}
+	seen := map[string]bool{}
+	for _, raw := range selectors {
+		vs, err := promql.ParseSeriesSelector(raw)
+		if err != nil {
+			h.writePromError(w, err)
+			return
+		}
+		found, err := h.engine.Series(r.Context(), vs)
+		if err != nil {
+			h.writePromError(w, err)
+			return
+		}
+		for _, l := range found {
+			key, _ := json.Marshal(l)
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				out = append(out, l)
+			}
+		}
+	}
+	writeProm(w, out)
+}
+
+// handlePromMetadata answers Grafana's metadata probe; no metric metadata
+// is kept.
+func (h *Handler) handlePromMetadata(w http.ResponseWriter, r *http.Request) {
+	writeProm(w, map[string]any{})
+}
+
+func (h *Handler) handlePromBuildInfo(w http.ResponseWriter, r *http.Request) {
+	writeProm(w, map[string]string{"version": "2.40.0", "application": "home-telemetry"})
+}
+
+func promResult(v promql.Value) any {
+	switch v := v.(type) {
+	case promql.Scalar:
+		return promPoint(v.T, v.V)
+	case promql.Vector:
+		out := make([]promSeries, 0, len(v))
+		for _, s := range v {
+			out = append(out, promSeries{Metric: s.Labels, Value: promPoint(s.T, s.V)})
+		}
+		return out
+	case promql.Matrix:
+		out := make([]promSeries, 0, len(v))
+		for _, s := range v {
+			values := make([][]any, 0, len(s.Points))
+			for _, p := range s.Points {
+				values = append(values, promPoint(p.T, p.V))
+			}
+			out = append(out, promSeries{Metric: s.Labels, Values: values})
+		}
+		return out
+	}
+	return nil
+}
+
+func promPoint(t int64, v float64) []any {
+	return []any{float64(t) / 1000, strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// parsePromTime accepts unix seconds (with fraction) or RFC3339.
+func parsePromTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, fmt.Errorf("%w: missing time", errPromBadParam)
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(secs) && !math.IsInf(secs, 0) {
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: cannot parse %q as a timestamp", errPromBadParam, v)
+	}
+	return t, nil
+}
+
+// parsePromDuration accepts seconds or a Prometheus duration such as 1m.
+func parsePromDuration(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if secs, perr := strconv.ParseFloat(v, 64); perr == nil {
+		if secs > 0 && !math.IsInf(secs, 0) {
+			d = time.Duration(secs * float64(time.Second))
+		}
+	} else {
+		d, err = promql.ParseDuration(v)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: cannot parse %q as a positive duration", errPromBadParam, v)
+	}
+	// Timestamps have millisecond resolution.
+	if d < time.Millisecond {
+		return 0, fmt.Errorf("%w: duration %q is below 1ms", errPromBadParam, v)
+	}
+	return d, nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePromDuration(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"15":    15 * time.Second,
+		"0.5":   500 * time.Millisecond,
+		"0.001": time.Millisecond,
+		"1m":    time.Minute,
+		"1ms":   time.Millisecond,
+	} {
+		got, err := parsePromDuration(v)
+		if err != nil || got != want {
+			t.Errorf("parsePromDuration(%q) = %v, %v; want %v", v, got, err, want)
+		}
+	}
+	for _, v := range []string{"", "0", "-1", "0.0001", "NaN", "Inf", "abc"} {
+		if _, err := parsePromDuration(v); !errors.Is(err, errPromBadParam) {
+			t.Errorf("parsePromDuration(%q) error = %v, want errPromBadParam", v, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"home-telemetry/server/internal/ingest"
+)
+
+const maxRemoteWriteBody = 32 << 20
+
+// @Summary Prometheus remote_write receiver
+// @Description Accepts snappy compressed protobuf WriteRequests (remote_write 1.0). The metric is __name__, the node is the instance host without port (or job), and the other labels except instance are stored as labels. Point Prometheus at it with remote_write url https://host:8443/api/v1/prom/write and authorization credentials set to the ingest token.
+// @Tags ingest
+// @Accept application/x-protobuf
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /prom/write [post]
+func (h *Handler) handleRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRemoteWriteBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRemoteWriteBody {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rows, dropped, err := ingest.RemoteWrite(body)
+	if err != nil {
+		// 4xx tells Prometheus not to retry a request it cannot fix.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if dropped > 0 {
+		h.logger.Printf("remote_write: dropped %d samples without a node or with non-finite values", dropped)
+	}
+
+	if err := h.stores.InsertRows(r.Context(), rows.Nodes, rows.Rows); err != nil {
+		h.logger.Printf("remote_write error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -18,3 +18,46 @@ func TokenMiddleware(expected string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// InfluxTokenMiddleware also accepts the ways Influx clients send credentials:
+// "Authorization: Token <token>", basic auth or the p query parameter with
+// the token as password.
+func InfluxTokenMiddleware(expected string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			header := r.Header.Get("Authorization")
+			_, password, basic := r.BasicAuth()
+			ok := header == "Bearer "+expected ||
+				header == "Token "+expected ||
+				(basic && password == expected) ||
+				r.URL.Query().Get("p") == expected
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// QueryTokenMiddleware also accepts the token as the given query parameter,
+// for webhook senders that cannot set headers.
+func QueryTokenMiddleware(expected, param string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer "+expected && r.URL.Query().Get(param) != expected {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
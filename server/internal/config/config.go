@@ -1,6 +1,9 @@
 ﻿package config
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 type Config struct {
 	HTTPAddr    string
@@ -10,6 +13,17 @@ type Config struct {
 	TLSCertPath string
 	TLSKeyPath  string
 	TLSEnabled  bool
+	AutoMigrate bool
+	// InfluxNodeTag is the line protocol tag that selects the node id.
+	InfluxNodeTag string
+	// StatsDAddr enables the StatsD UDP listener when set, e.g. ":8125".
+	StatsDAddr          string
+	StatsDNodeID        string
+	StatsDFlushInterval time.Duration
+	// MQTTConfig is the path of the MQTT bridge config; empty disables it.
+	MQTTConfig string
+	// HooksConfig is the path of the webhook mappings file.
+	HooksConfig string
 }
 
 func LoadFromEnv() Config {
@@ -20,15 +34,29 @@ func LoadFromEnv() Config {
 	tlsCert := getenv("TLS_CERT", "")
 	tlsKey := getenv("TLS_KEY", "")
 	tlsEnabled := tlsCert != "" && tlsKey != ""
+	autoMigrate := getenv("AUTO_MIGRATE", "false") == "true"
+	influxNodeTag := getenv("INFLUX_NODE_TAG", "host")
+	statsdAddr := getenv("STATSD_ADDR", "")
+	statsdNodeID := getenv("STATSD_NODE_ID", "statsd")
+	statsdFlush := getduration("STATSD_FLUSH_INTERVAL", 10*time.Second)
+	mqttConfig := getenv("MQTT_CONFIG", "")
+	hooksConfig := getenv("HOOKS_CONFIG", "")
 
 	return Config{
-		HTTPAddr:    addr,
-		DatabaseURL: db,
-		AuthToken:   token,
-		CORSOrigins: origins,
-		TLSCertPath: tlsCert,
-		TLSKeyPath:  tlsKey,
-		TLSEnabled:  tlsEnabled,
+		HTTPAddr:            addr,
+		DatabaseURL:         db,
+		AuthToken:           token,
+		CORSOrigins:         origins,
+		TLSCertPath:         tlsCert,
+		TLSKeyPath:          tlsKey,
+		TLSEnabled:          tlsEnabled,
+		AutoMigrate:         autoMigrate,
+		InfluxNodeTag:       influxNodeTag,
+		StatsDAddr:          statsdAddr,
+		StatsDNodeID:        statsdNodeID,
+		StatsDFlushInterval: statsdFlush,
+		MQTTConfig:          mqttConfig,
+		HooksConfig:         hooksConfig,
 	}
 }
 
@@ -37,4 +65,11 @@ func getenv(key, def string) string {
 		return v
 	}
 	return def
+}
+
+func getduration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
 }
@@ -0,0 +1,28 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Hooks maps webhook names to the mapping applied to their JSON bodies.
+type Hooks map[string]Mapping
+
+// LoadHooks reads a JSON object of hook name to Mapping.
+func LoadHooks(path string) (Hooks, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks Hooks
+	if err := json.Unmarshal(body, &hooks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, m := range hooks {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: hook %s: %w", path, name, err)
+		}
+	}
+	return hooks, nil
+}
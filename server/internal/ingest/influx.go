@@ -0,0 +1,236 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-telemetry/server/internal/types"
+)
+
+// LineOptions controls how line protocol is mapped onto nodes and times.
+type LineOptions struct {
+	// NodeTag is the tag holding the node id; it is not stored as a label.
+	NodeTag string
+	// DefaultNode is used for lines without NodeTag. Empty rejects them.
+	DefaultNode string
+	// Precision is the unit of line timestamps; zero means nanoseconds.
+	Precision time.Duration
+	// Now stamps lines without a timestamp.
+	Now time.Time
+}
+
+// LineError reports the line a parse error was found on (1-based).
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePrecision maps an Influx precision parameter (v1 or v2 spelling) to
+// a duration. Empty means nanoseconds.
+func ParsePrecision(v string) (time.Duration, error) {
+	switch v {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µs":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q", v)
+}
+
+// LineProtocol parses InfluxDB line protocol. Each numeric or boolean field
+// becomes a row named measurement.field, or just measurement for a field
+// called "value"; booleans are stored as 1 and 0. Tags other than the node
+// tag become labels. String fields are counted in skipped. Any malformed
+// line fails the whole body with a *LineError.
+func LineProtocol(body []byte, opts LineOptions) (rows *NodeRows, skipped int, err error) {
+	if opts.Precision <= 0 {
+		opts.Precision = time.Nanosecond
+	}
+	rows = newNodeRows()
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		n, err := parseLine(rows, line, opts)
+		if err != nil {
+			return nil, 0, &LineError{Line: i + 1, Err: err}
+		}
+		skipped += n
+	}
+	return rows, skipped, nil
+}
+
+func parseLine(rows *NodeRows, line string, opts LineOptions) (int, error) {
+	keyEnd := indexUnescaped(line, ' ', false)
+	if keyEnd < 0 {
+		return 0, fmt.Errorf("missing fields")
+	}
+	key, rest := line[:keyEnd], strings.TrimLeft(line[keyEnd:], " ")
+
+	fieldEnd := indexUnescaped(rest, ' ', true)
+	fieldSet, stamp := rest, ""
+	if fieldEnd >= 0 {
+		fieldSet, stamp = rest[:fieldEnd], strings.TrimSpace(rest[fieldEnd:])
+	}
+
+	parts := splitUnescaped(key, ',', false)
+	measurement := unescape(parts[0])
+	if measurement == "" {
+		return 0, fmt.Errorf("missing measurement")
+	}
+
+	nodeID := opts.DefaultNode
+	var labels map[string]string
+	for _, tag := range parts[1:] {
+		k, v, ok := cutUnescaped(tag, '=')
+		if !ok || k == "" || v == "" {
+			return 0, fmt.Errorf("invalid tag %q", tag)
+		}
+		k, v = unescape(k), unescape(v)
+		if k == opts.NodeTag {
+			nodeID = v
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[k] = v
+	}
+	if nodeID == "" {
+		return 0, fmt.Errorf("missing %q tag", opts.NodeTag)
+	}
+
+	ts := opts.Now
+	if stamp != "" {
+		n, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", stamp)
+		}
+		ts = time.Unix(0, 0).Add(time.Duration(n) * opts.Precision)
+	}
+	ts = ts.UTC()
+
+	fields := splitUnescaped(fieldSet, ',', true)
+	skipped := 0
+	var out []types.MetricRow
+	for _, field := range fields {
+		k, raw, ok := cutUnescaped(field, '=')
+		if !ok || k == "" || raw == "" {
+			return 0, fmt.Errorf("invalid field %q", field)
+		}
+		value, numeric, err := parseFieldValue(raw)
+		if err != nil {
+			return 0, fmt.Errorf("field %s: %w", unescape(k), err)
+		}
+		if !numeric || math.IsNaN(value) || math.IsInf(value, 0) {
+			skipped++
+			continue
+		}
+		metric := measurement
+		if k = unescape(k); k != "value" {
+			metric += "." + k
+		}
+		out = append(out, types.MetricRow{Time: ts, Metric: metric, Value: value, Labels: labels})
+	}
+	for _, row := range out {
+		rows.add(nodeID, row)
+	}
+	return skipped, nil
+}
+
+// parseFieldValue returns the value of a field and whether it is numeric.
+// String fields are valid but not numeric.
+func parseFieldValue(raw string) (float64, bool, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if raw[0] == '"' {
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return 0, false, fmt.Errorf("unterminated string")
+		}
+		return 0, false, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return float64(v), true, err
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(v), true, err
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	return v, true, err
+}
+
+// indexUnescaped finds the first sep not preceded by a backslash and, when
+// quoted is set, not inside a double quoted string.
+func indexUnescaped(s string, sep byte, quoted bool) int {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case quoted && c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	var out []string
+	for {
+		i := indexUnescaped(s, sep, quoted)
+		if i < 0 {
+			return append(out, s)
+		}
+		out = append(out, s[:i])
+		s = s[i+1:]
+	}
+}
+
+func cutUnescaped(s string, sep byte) (before, after string, found bool) {
+	if i := indexUnescaped(s, sep, false); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`,= \"`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
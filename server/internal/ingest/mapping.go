@@ -0,0 +1,274 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-telemetry/server/internal/types"
+)
+
+// Mapping turns an arbitrary JSON document into metric rows. String fields
+// may contain {var} placeholders filled from the source, such as MQTT topic
+// segments ({0}, {1}, ...). Paths are dotted with optional indexes, e.g.
+// "ENERGY.Power" or "sensors[0].value"; a leading "$." is allowed.
+type Mapping struct {
+	// Node is the node id template; NodePath reads it from the payload
+	// instead when set.
+	Node     string `json:"node"`
+	NodePath string `json:"node_path"`
+	// Metrics lists the fields to store. When empty, every numeric or
+	// boolean leaf is stored under MetricPrefix plus its dotted path.
+	Metrics      []MetricMapping `json:"metrics"`
+	MetricPrefix string          `json:"metric_prefix"`
+	// Labels are added to every row; values are templates. LabelPaths
+	// read label values from the payload.
+	Labels     map[string]string `json:"labels"`
+	LabelPaths map[string]string `json:"label_paths"`
+	// Timestamp is an optional path to an RFC3339 string or unix seconds,
+	// milliseconds or nanoseconds. Rows are stamped with the receive time
+	// when it is empty or missing.
+	Timestamp string `json:"timestamp"`
+}
+
+type MetricMapping struct {
+	Path   string            `json:"path"`
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	// Scale multiplies the value, e.g. 0.001 for mW to W. Zero means 1.
+	Scale float64 `json:"scale"`
+}
+
+// Validate checks that the mapping can produce a node id.
+func (m Mapping) Validate() error {
+	if m.Node == "" && m.NodePath == "" {
+		return fmt.Errorf("node or node_path required")
+	}
+	for i, mm := range m.Metrics {
+		if mm.Path == "" || mm.Metric == "" {
+			return fmt.Errorf("metrics[%d]: path and metric required", i)
+		}
+	}
+	return nil
+}
+
+// Rows applies the mapping to a decoded JSON document. Missing or
+// non-numeric fields are skipped; an empty result is not an error.
+func (m Mapping) Rows(doc any, vars map[string]string, now time.Time) (string, []types.MetricRow, error) {
+	nodeID := expand(m.Node, vars)
+	if m.NodePath != "" {
+		v, ok := Lookup(doc, m.NodePath)
+		if !ok {
+			return "", nil, fmt.Errorf("node path %q not found", m.NodePath)
+		}
+		nodeID = fmt.Sprint(v)
+	}
+	if nodeID == "" {
+		return "", nil, fmt.Errorf("empty node id")
+	}
+	if placeholder.MatchString(nodeID) {
+		return "", nil, fmt.Errorf("node id %q has unfilled placeholders", nodeID)
+	}
+
+	ts := now.UTC()
+	if m.Timestamp != "" {
+		if v, ok := Lookup(doc, m.Timestamp); ok {
+			parsed, err := parseTimestamp(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("timestamp: %w", err)
+			}
+			ts = parsed
+		}
+	}
+
+	base := map[string]string{}
+	for k, v := range m.Labels {
+		base[k] = expand(v, vars)
+	}
+	for k, path := range m.LabelPaths {
+		if v, ok := Lookup(doc, path); ok {
+			base[k] = fmt.Sprint(v)
+		}
+	}
+
+	var rows []types.MetricRow
+	add := func(metric string, v float64, extra map[string]string) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		labels := base
+		if len(extra) > 0 {
+			labels = make(map[string]string, len(base)+len(extra))
+			for k, v := range base {
+				labels[k] = v
+			}
+			for k, v := range extra {
+				labels[k] = expand(v, vars)
+			}
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+		rows = append(rows, types.MetricRow{Time: ts, Metric: metric, Value: v, Labels: labels})
+	}
+
+	if len(m.Metrics) == 0 {
+		for _, leaf := range numericLeaves(doc, "") {
+			add(m.MetricPrefix+leaf.path, leaf.value, nil)
+		}
+		return nodeID, rows, nil
+	}
+	for _, mm := range m.Metrics {
+		raw, ok := Lookup(doc, mm.Path)
+		if !ok {
+			continue
+		}
+		v, ok := Number(raw)
+		if !ok {
+			continue
+		}
+		if mm.Scale != 0 {
+			v *= mm.Scale
+		}
+		add(expand(mm.Metric, vars), v, mm.Labels)
+	}
+	return nodeID, rows, nil
+}
+
+var placeholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+func expand(tmpl string, vars map[string]string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+	return placeholder.ReplaceAllStringFunc(tmpl, func(s string) string {
+		if v, ok := vars[s[1:len(s)-1]]; ok {
+			return v
+		}
+		return s
+	})
+}
+
+// Lookup follows a dotted path with optional [n] indexes through decoded JSON.
+func Lookup(doc any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	cur := doc
+	for path != "" {
+		var key string
+		if path[0] == '[' {
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, false
+			}
+			i, err := strconv.Atoi(path[1:end])
+			arr, ok := cur.([]any)
+			if err != nil || !ok || i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			cur = arr[i]
+			path = strings.TrimPrefix(path[end+1:], ".")
+			continue
+		}
+		end := strings.IndexAny(path, ".[")
+		if end < 0 {
+			key, path = path, ""
+		} else {
+			key, path = path[:end], strings.TrimPrefix(path[end:], ".")
+		}
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Number converts JSON numbers, booleans and numeric or ON/OFF strings.
+func Number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		switch strings.ToUpper(strings.TrimSpace(v)) {
+		case "ON", "TRUE":
+			return 1, true
+		case "OFF", "FALSE":
+			return 0, true
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type leaf struct {
+	path  string
+	value float64
+}
+
+// numericLeaves lists numeric and boolean values of nested objects in path
+// order. Arrays and strings are skipped.
+func numericLeaves(doc any, prefix string) []leaf {
+	var out []leaf
+	switch v := doc.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			out = append(out, numericLeaves(v[k], p)...)
+		}
+	case float64, json.Number, bool:
+		if n, ok := Number(v); ok && prefix != "" {
+			out = append(out, leaf{prefix, n})
+		}
+	}
+	return out
+}
+
+func parseTimestamp(v any) (time.Time, error) {
+	if s, ok := v.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t.UTC(), nil
+		}
+		// Tasmota and friends send local time without a zone.
+		if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	n, ok := Number(v)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unsupported value %v", v)
+	}
+	switch {
+	case n > 1e17:
+		return time.Unix(0, int64(n)).UTC(), nil
+	case n > 1e11:
+		return time.UnixMilli(int64(n)).UTC(), nil
+	default:
+		secs, frac := math.Modf(n)
+		return time.Unix(int64(secs), int64(frac*1e9)).UTC(), nil
+	}
+}
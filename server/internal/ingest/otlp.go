@@ -0,0 +1,373 @@
+package ingest
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"home-telemetry/server/internal/types"
+)
+
+// DecodeOTLP parses an OTLP ExportMetricsServiceRequest in protobuf or, when
+// isJSON is set, OTLP/JSON encoding. MetricsData shares the request's wire
+// format, which keeps the collector service packages out of the build.
+func DecodeOTLP(body []byte, isJSON bool) (*metricspb.MetricsData, error) {
+	req := &metricspb.MetricsData{}
+	if isJSON {
+		return req, protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, req)
+	}
+	return req, proto.Unmarshal(body, req)
+}
+
+// OTLP converts metrics to rows. The node is the host.name resource
+// attribute, or service.name when there is none (service.name is kept as
+// the service label otherwise); resources with neither are rejected.
+// service.instance.id becomes the instance label. Point
+// attributes become labels and the unit the unit label, like agent samples.
+//
+//   - gauges and cumulative sums are stored as is under the metric name
+//   - delta sums are turned into running totals by deltas, to be rolled back
+//     when the rows cannot be stored
+//   - histograms become name.count, name.sum and cumulative name.bucket rows
+//     labelled le, Prometheus style; exponential histograms only count and
+//     sum; summaries count, sum and name labelled quantile
+//
+// rejected counts the data points that were not stored.
+func OTLP(req *metricspb.MetricsData, deltas *DeltaBatch, now time.Time) (rows *NodeRows, rejected int) {
+	rows = newNodeRows()
+	for _, rm := range req.GetResourceMetrics() {
+		resource := attributes(rm.GetResource().GetAttributes())
+		nodeID := resource["host.name"]
+		var base map[string]string
+		if nodeID == "" {
+			nodeID = resource["service.name"]
+		} else if svc := resource["service.name"]; svc != "" {
+			base = map[string]string{"service": svc}
+		}
+		// Instances of one service on one node would otherwise write their
+		// counters into the same series.
+		if id := resource["service.instance.id"]; id != "" {
+			base = withLabel(base, "instance", id)
+		}
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				c := otlpConverter{rows: rows, nodeID: nodeID, deltas: deltas, now: now, metric: m.GetName(), unit: m.GetUnit(), base: base}
+				if nodeID == "" || c.metric == "" {
+					rejected += countPoints(m)
+					continue
+				}
+				rejected += c.convert(m)
+			}
+		}
+	}
+	return rows, rejected
+}
+
+type otlpConverter struct {
+	rows   *NodeRows
+	deltas *DeltaBatch
+	now    time.Time
+	nodeID string
+	metric string
+	unit   string
+	base   map[string]string
+}
+
+func (c otlpConverter) convert(m *metricspb.Metric) (rejected int) {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			rejected += c.number(p, false)
+		}
+	case *metricspb.Metric_Sum:
+		delta := data.Sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, p := range data.Sum.GetDataPoints() {
+			rejected += c.number(p, delta)
+		}
+	case *metricspb.Metric_Histogram:
+		delta := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, p := range data.Histogram.GetDataPoints() {
+			if noValue(p.GetFlags()) {
+				rejected++
+				continue
+			}
+			labels, ts := c.labels(p.GetAttributes()), c.time(p.GetTimeUnixNano())
+			c.emit(".count", labels, ts, float64(p.GetCount()), delta)
+			if p.Sum != nil {
+				c.emit(".sum", labels, ts, p.GetSum(), delta)
+			}
+			var cumulative uint64
+			bounds := p.GetExplicitBounds()
+			for i, n := range p.GetBucketCounts() {
+				cumulative += n
+				le := "+Inf"
+				if i < len(bounds) {
+					le = strconv.FormatFloat(bounds[i], 'f', -1, 64)
+				}
+				c.emit(".bucket", withLabel(labels, "le", le), ts, float64(cumulative), delta)
+			}
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		delta := data.ExponentialHistogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, p := range data.ExponentialHistogram.GetDataPoints() {
+			if noValue(p.GetFlags()) {
+				rejected++
+				continue
+			}
+			labels, ts := c.labels(p.GetAttributes()), c.time(p.GetTimeUnixNano())
+			c.emit(".count", labels, ts, float64(p.GetCount()), delta)
+			if p.Sum != nil {
+				c.emit(".sum", labels, ts, p.GetSum(), delta)
+			}
+		}
+	case *metricspb.Metric_Summary:
+		for _, p := range data.Summary.GetDataPoints() {
+			if noValue(p.GetFlags()) {
+				rejected++
+				continue
+			}
+			labels, ts := c.labels(p.GetAttributes()), c.time(p.GetTimeUnixNano())
+			c.emit(".count", labels, ts, float64(p.GetCount()), false)
+			c.emit(".sum", labels, ts, p.GetSum(), false)
+			for _, q := range p.GetQuantileValues() {
+				c.emit("", withLabel(labels, "quantile", strconv.FormatFloat(q.GetQuantile(), 'f', -1, 64)), ts, q.GetValue(), false)
+			}
+		}
+	default:
+		rejected += countPoints(m)
+	}
+	return rejected
+}
+
+func (c otlpConverter) number(p *metricspb.NumberDataPoint, delta bool) int {
+	if noValue(p.GetFlags()) {
+		return 1
+	}
+	var v float64
+	switch value := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		v = value.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		v = float64(value.AsInt)
+	default:
+		return 1
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 1
+	}
+	c.emit("", c.labels(p.GetAttributes()), c.time(p.GetTimeUnixNano()), v, delta)
+	return 0
+}
+
+func (c otlpConverter) emit(suffix string, labels map[string]string, ts time.Time, v float64, delta bool) {
+	metric := c.metric + suffix
+	if delta {
+		v = c.deltas.add(c.nodeID, metric, labels, v)
+	}
+	c.rows.add(c.nodeID, types.MetricRow{Time: ts, Metric: metric, Value: v, Labels: labels})
+}
+
+func (c otlpConverter) labels(attrs []*commonpb.KeyValue) map[string]string {
+	labels := attributes(attrs)
+	for k, v := range c.base {
+		labels[k] = v
+	}
+	if c.unit != "" {
+		labels["unit"] = c.unit
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+func (c otlpConverter) time(unixNano uint64) time.Time {
+	if unixNano == 0 {
+		return c.now.UTC()
+	}
+	return time.Unix(0, int64(unixNano)).UTC()
+}
+
+func withLabel(labels map[string]string, k, v string) map[string]string {
+	out := make(map[string]string, len(labels)+1)
+	for lk, lv := range labels {
+		out[lk] = lv
+	}
+	out[k] = v
+	return out
+}
+
+func noValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+// attributes flattens scalar attribute values to strings; arrays, maps and
+// bytes are skipped.
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	out := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			out[kv.GetKey()] = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			out[kv.GetKey()] = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			out[kv.GetKey()] = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			out[kv.GetKey()] = strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+		}
+	}
+	return out
+}
+
+func countPoints(m *metricspb.Metric) int {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
+
+// Deltas turns delta temporality points into running totals so they can be
+// stored and queried like cumulative counters. Totals live in memory and
+// start over when the server restarts, which rate() and increase() treat as
+// a counter reset. Series not updated for a day are forgotten.
+type Deltas struct {
+	mu        sync.Mutex
+	totals    map[string]*deltaTotal
+	lastSweep time.Time
+}
+
+type deltaTotal struct {
+	value float64
+	seen  time.Time
+}
+
+const deltaIdle = 24 * time.Hour
+
+func NewDeltas() *Deltas {
+	return &Deltas{totals: map[string]*deltaTotal{}}
+}
+
+// Batch starts collecting the delta points of one request. Increments are
+// added to the running totals as they are converted, under the lock, so
+// concurrent requests for one series get increasing totals; Rollback takes
+// them back out when the rows could not be stored, so the exporter's retry
+// is not counted twice.
+func (d *Deltas) Batch(now time.Time) *DeltaBatch {
+	d.mu.Lock()
+	if now.Sub(d.lastSweep) > time.Hour {
+		for k, t := range d.totals {
+			if now.Sub(t.seen) > deltaIdle {
+				delete(d.totals, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	d.mu.Unlock()
+	return &DeltaBatch{deltas: d, now: now, added: map[string]float64{}}
+}
+
+// DeltaBatch records the increments one request added to the totals.
+type DeltaBatch struct {
+	deltas *Deltas
+	now    time.Time
+	added  map[string]float64
+}
+
+// add adds v to the running total and returns the new total.
+func (b *DeltaBatch) add(nodeID, metric string, labels map[string]string, v float64) float64 {
+	key := deltaKey(nodeID, metric, labels)
+	b.added[key] += v
+
+	d := b.deltas
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.totals[key]
+	if !ok {
+		t = &deltaTotal{}
+		d.totals[key] = t
+	}
+	t.value += v
+	t.seen = b.now
+	return t.value
+}
+
+// Rollback subtracts the batch's increments from the running totals.
+func (b *DeltaBatch) Rollback() {
+	d := b.deltas
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, v := range b.added {
+		if t, ok := d.totals[key]; ok {
+			t.value -= v
+		}
+	}
+	b.added = map[string]float64{}
+}
+
+func deltaKey(nodeID, metric string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(nodeID)
+	b.WriteByte(0)
+	b.WriteString(metric)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// OTLPResponse encodes an ExportMetricsServiceResponse, reporting rejected
+// points as a partial success.
+func OTLPResponse(rejected int, message string, isJSON bool) []byte {
+	if isJSON {
+		if rejected == 0 {
+			return []byte("{}")
+		}
+		body, _ := json.Marshal(map[string]any{"partialSuccess": map[string]string{
+			"rejectedDataPoints": strconv.Itoa(rejected),
+			"errorMessage":       message,
+		}})
+		return body
+	}
+	if rejected == 0 {
+		return []byte{}
+	}
+	// ExportMetricsPartialSuccess{rejected_data_points = 1, error_message = 2}
+	// as field 1 of the response.
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, uint64(rejected))
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, message)
+	var out []byte
+	out = protowire.AppendTag(out, 1, protowire.BytesType)
+	return protowire.AppendBytes(out, partial)
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const deltaSumJSON = `{"resourceMetrics":[{"resource":{"attributes":[
+	{"key":"host.name","value":{"stringValue":"nas"}},
+	{"key":"service.name","value":{"stringValue":"backup"}},
+	{"key":"service.instance.id","value":{"stringValue":"%s"}}]},
+	"scopeMetrics":[{"metrics":[{"name":"jobs","sum":{"aggregationTemporality":1,"isMonotonic":true,
+	"dataPoints":[{"timeUnixNano":"1700000000000000000","asInt":"%d"}]}}]}]}]}`
+
+func otlpValues(t *testing.T, b *DeltaBatch, instance string, v int) []float64 {
+	t.Helper()
+	req, err := DecodeOTLP([]byte(fmt.Sprintf(deltaSumJSON, instance, v)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, rejected := OTLP(req, b, b.now)
+	if rejected != 0 {
+		t.Fatalf("rejected %d points", rejected)
+	}
+	var out []float64
+	for _, r := range rows.Rows["nas"] {
+		if r.Labels["instance"] != instance || r.Labels["service"] != "backup" {
+			t.Errorf("labels = %v", r.Labels)
+		}
+		out = append(out, r.Value)
+	}
+	return out
+}
+
+func TestDeltaTotals(t *testing.T) {
+	d := NewDeltas()
+	now := time.Now()
+
+	if got := otlpValues(t, d.Batch(now), "a", 10); got[0] != 10 {
+		t.Fatalf("first total = %v, want 10", got)
+	}
+
+	// Overlapping requests must see increasing totals.
+	first, second := d.Batch(now), d.Batch(now)
+	if got := otlpValues(t, first, "a", 5); got[0] != 15 {
+		t.Errorf("total = %v, want 15", got)
+	}
+	if got := otlpValues(t, second, "a", 3); got[0] != 18 {
+		t.Errorf("total = %v, want 18", got)
+	}
+
+	// A failed request is taken back out, so its retry counts once.
+	failed := d.Batch(now)
+	otlpValues(t, failed, "a", 7)
+	failed.Rollback()
+	if got := otlpValues(t, d.Batch(now), "a", 7); got[0] != 25 {
+		t.Errorf("total after rollback and retry = %v, want 25", got)
+	}
+
+	// Another instance of the service has its own series.
+	if got := otlpValues(t, d.Batch(now), "b", 1); got[0] != 1 {
+		t.Errorf("second instance total = %v, want 1", got)
+	}
+}
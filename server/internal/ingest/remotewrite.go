@@ -0,0 +1,226 @@
+// Package ingest converts third-party write formats into metric rows.
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"home-telemetry/server/internal/types"
+)
+
+// MaxRemoteWriteBytes caps the decompressed size of a remote_write request.
+const MaxRemoteWriteBytes = 64 << 20
+
+// NodeRows holds converted rows grouped by node, in first-seen node order.
+type NodeRows struct {
+	Nodes []string
+	Rows  map[string][]types.MetricRow
+}
+
+func newNodeRows() *NodeRows {
+	return &NodeRows{Rows: map[string][]types.MetricRow{}}
+}
+
+func (n *NodeRows) add(nodeID string, row types.MetricRow) {
+	if _, ok := n.Rows[nodeID]; !ok {
+		n.Nodes = append(n.Nodes, nodeID)
+	}
+	n.Rows[nodeID] = append(n.Rows[nodeID], row)
+}
+
+// Len returns the total number of rows.
+func (n *NodeRows) Len() int {
+	total := 0
+	for _, rows := range n.Rows {
+		total += len(rows)
+	}
+	return total
+}
+
+// RemoteWrite decodes a snappy compressed Prometheus remote_write request
+// (prometheus.WriteRequest, protocol 1.0). __name__ becomes the metric, the
+// instance host (without port), or job when there is no instance, becomes
+// the node, and the remaining labels except instance are kept. Series with
+// neither instance nor job, and NaN or infinite samples (including staleness
+// markers), are counted in dropped.
+func RemoteWrite(body []byte) (rows *NodeRows, dropped int, err error) {
+	n, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n > MaxRemoteWriteBytes {
+		return nil, 0, fmt.Errorf("decompressed request is %d bytes, limit is %d", n, MaxRemoteWriteBytes)
+	}
+	buf, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows = newNodeRows()
+	err = eachField(buf, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil // metadata and anything newer
+		}
+		d, err := addTimeSeries(rows, v)
+		dropped += d
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, dropped, nil
+}
+
+type promSample struct {
+	value float64
+	ts    int64
+}
+
+func addTimeSeries(rows *NodeRows, buf []byte) (int, error) {
+	labels := map[string]string{}
+	var samples []promSample
+	err := eachField(buf, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name, value, err := decodeLabel(v)
+			if err != nil {
+				return err
+			}
+			labels[name] = value
+		case 2:
+			s, err := decodeSample(v)
+			if err != nil {
+				return err
+			}
+			samples = append(samples, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	metric := labels["__name__"]
+	nodeID := instanceHost(labels["instance"])
+	if nodeID == "" {
+		nodeID = labels["job"]
+	}
+	if metric == "" || nodeID == "" {
+		return len(samples), nil
+	}
+	delete(labels, "__name__")
+	delete(labels, "instance")
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	dropped := 0
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			dropped++
+			continue
+		}
+		rows.add(nodeID, types.MetricRow{
+			Time:   time.UnixMilli(s.ts).UTC(),
+			Metric: metric,
+			Value:  s.value,
+			Labels: labels,
+		})
+	}
+	return dropped, nil
+}
+
+func decodeLabel(buf []byte) (name, value string, err error) {
+	err = eachField(buf, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			name = string(v)
+		case 2:
+			value = string(v)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func decodeSample(buf []byte) (promSample, error) {
+	var s promSample
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(buf)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.value = math.Float64frombits(v)
+			buf = buf[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(buf)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.ts = int64(v)
+			buf = buf[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, buf)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			buf = buf[n:]
+		}
+	}
+	return s, nil
+}
+
+// eachField calls fn for every field of a protobuf message. v is the payload
+// of length-delimited fields and nil for other wire types.
+func eachField(buf []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(buf)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, buf)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func instanceHost(instance string) string {
+	if instance == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(instance)
+	if err != nil {
+		return instance
+	}
+	return host
+}
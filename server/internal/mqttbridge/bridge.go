@@ -0,0 +1,206 @@
+// Package mqttbridge subscribes to an MQTT broker and stores mapped readings.
+package mqttbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"home-telemetry/server/internal/ingest"
+	"home-telemetry/server/internal/store"
+	"home-telemetry/server/internal/types"
+)
+
+const (
+	flushInterval = time.Second
+	flushRows     = 5000
+)
+
+// Config is read from the JSON file named by MQTT_CONFIG.
+type Config struct {
+	Broker        string         `json:"broker"`
+	ClientID      string         `json:"client_id"`
+	Username      string         `json:"username"`
+	Password      string         `json:"password"`
+	QoS           byte           `json:"qos"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// Subscription maps messages on an MQTT topic filter (+ and # wildcards)
+// to rows. Mapping templates can use {0}, {1}, ... for topic segments and
+// {topic} for the whole topic. Payloads that are not JSON objects or arrays
+// are available under the path "value".
+type Subscription struct {
+	Topic string `json:"topic"`
+	ingest.Mapping
+}
+
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Broker == "" {
+		return cfg, fmt.Errorf("%s: broker required", path)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "home-telemetry"
+	}
+	if cfg.QoS > 2 {
+		return cfg, fmt.Errorf("%s: qos must be 0, 1 or 2", path)
+	}
+	for i, sub := range cfg.Subscriptions {
+		if sub.Topic == "" {
+			return cfg, fmt.Errorf("%s: subscriptions[%d]: topic required", path, i)
+		}
+		if err := sub.Validate(); err != nil {
+			return cfg, fmt.Errorf("%s: subscriptions[%d]: %w", path, i, err)
+		}
+	}
+	return cfg, nil
+}
+
+type batch struct {
+	nodeID string
+	rows   []types.MetricRow
+}
+
+// Bridge keeps a connection to the broker, resubscribing after reconnects,
+// and writes received rows in batches.
+type Bridge struct {
+	cfg    Config
+	stores store.Stores
+	logger *log.Logger
+	client mqtt.Client
+	queue  chan batch
+}
+
+func New(cfg Config, stores store.Stores, logger *log.Logger) *Bridge {
+	b := &Bridge{cfg: cfg, stores: stores, logger: logger, queue: make(chan batch, 1024)}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Printf("mqtt connection lost: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+// Run connects and writes rows until ctx is done. Connection failures are
+// retried in the background, so Run only returns when ctx ends.
+func (b *Bridge) Run(ctx context.Context) {
+	b.client.Connect()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	pending := map[string][]types.MetricRow{}
+	var nodes []string
+	count := 0
+	flush := func(ctx context.Context) {
+		if count == 0 {
+			return
+		}
+		if err := b.stores.InsertRows(ctx, nodes, pending); err != nil {
+			b.logger.Printf("mqtt store error: %v (%d rows dropped)", err, count)
+		}
+		pending = map[string][]types.MetricRow{}
+		nodes = nil
+		count = 0
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.client.Disconnect(250)
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			flush(ctx)
+		case item := <-b.queue:
+			if _, ok := pending[item.nodeID]; !ok {
+				nodes = append(nodes, item.nodeID)
+			}
+			pending[item.nodeID] = append(pending[item.nodeID], item.rows...)
+			count += len(item.rows)
+			if count >= flushRows {
+				flush(ctx)
+			}
+		}
+	}
+}
+
+// onConnect (re)subscribes; the session is clean, so the broker forgets
+// subscriptions when the connection drops.
+func (b *Bridge) onConnect(c mqtt.Client) {
+	b.logger.Printf("mqtt connected to %s", b.cfg.Broker)
+	for _, sub := range b.cfg.Subscriptions {
+		token := c.Subscribe(sub.Topic, b.cfg.QoS, func(_ mqtt.Client, msg mqtt.Message) {
+			b.handle(sub, msg.Topic(), msg.Payload())
+		})
+		go func() {
+			if token.Wait() && token.Error() != nil {
+				b.logger.Printf("mqtt subscribe %s: %v", sub.Topic, token.Error())
+			}
+		}()
+	}
+}
+
+func (b *Bridge) handle(sub Subscription, topic string, payload []byte) {
+	vars := map[string]string{"topic": topic}
+	for i, seg := range strings.Split(topic, "/") {
+		vars[strconv.Itoa(i)] = seg
+	}
+
+	nodeID, rows, err := sub.Rows(decodePayload(payload), vars, time.Now())
+	if err != nil {
+		b.logger.Printf("mqtt %s: %v", topic, err)
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	select {
+	case b.queue <- batch{nodeID: nodeID, rows: rows}:
+	default:
+		b.logger.Printf("mqtt queue full, dropping message on %s", topic)
+	}
+}
+
+func decodePayload(payload []byte) any {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var doc any
+		if err := json.Unmarshal(trimmed, &doc); err == nil {
+			return doc
+		}
+	}
+	var v any
+	if err := json.Unmarshal(trimmed, &v); err != nil {
+		v = string(trimmed)
+	}
+	return map[string]any{"value": v}
+}
@@ -0,0 +1,595 @@
+package promql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"home-telemetry/server/internal/store"
+	"home-telemetry/server/internal/types"
+)
+
+const nameLabel = "__name__"
+
+type Labels map[string]string
+
+type Point struct {
+	T int64 // unix milliseconds
+	V float64
+}
+
+type Sample struct {
+	Labels Labels
+	Point
+}
+
+type Series struct {
+	Labels Labels
+	Points []Point
+}
+
+// Value is a query result: Vector, Matrix or Scalar.
+type Value interface {
+	Type() string
+}
+
+type Vector []Sample
+type Matrix []Series
+type Scalar Point
+
+func (Vector) Type() string { return "vector" }
+func (Matrix) Type() string { return "matrix" }
+func (Scalar) Type() string { return "scalar" }
+
+// Engine evaluates PromQL over the metrics store. Stored metric and label
+// names are exposed with characters outside [a-zA-Z0-9_:] replaced by "_",
+// so cpu.temp_c becomes cpu_temp_c.
+type Engine struct {
+	Stores        store.Stores
+	LookbackDelta time.Duration
+	MaxSamples    int
+	MaxSteps      int
+}
+
+func NewEngine(stores store.Stores) *Engine {
+	return &Engine{
+		Stores:        stores,
+		LookbackDelta: 5 * time.Minute,
+		MaxSamples:    5_000_000,
+		MaxSteps:      11_000,
+	}
+}
+
+// ErrBadQuery wraps errors caused by the query rather than the server.
+var ErrBadQuery = errors.New("bad query")
+
+// Instant evaluates expr at ts.
+func (e *Engine) Instant(ctx context.Context, expr Expr, ts time.Time) (Value, error) {
+	ev, err := e.prepare(ctx, expr, ts, ts)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ev.eval(expr, ts.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(matrixArg); ok {
+		return m.toMatrix(), nil
+	}
+	return v, nil
+}
+
+// Range evaluates expr at every step from start to end.
+func (e *Engine) Range(ctx context.Context, expr Expr, start, end time.Time, step time.Duration) (Matrix, error) {
+	// Points are evaluated at millisecond timestamps; a smaller step would
+	// never advance.
+	if step.Milliseconds() <= 0 {
+		return nil, fmt.Errorf("%w: step must be at least 1ms", ErrBadQuery)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: end is before start", ErrBadQuery)
+	}
+	if n := end.Sub(start)/step + 1; e.MaxSteps > 0 && int(n) > e.MaxSteps {
+		return nil, fmt.Errorf("%w: %d steps exceeds the limit of %d, use a larger step", ErrBadQuery, n, e.MaxSteps)
+	}
+
+	ev, err := e.prepare(ctx, expr, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	out := Matrix{}
+	index := map[string]int{}
+	add := func(l Labels, p Point) {
+		key := signature(l, false)
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, Series{Labels: l})
+		}
+		out[i].Points = append(out[i].Points, p)
+	}
+
+	stepMs := step.Milliseconds()
+	for t := start.UnixMilli(); t <= end.UnixMilli(); t += stepMs {
+		v, err := ev.eval(expr, t)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case Scalar:
+			add(Labels{}, Point{T: t, V: v.V})
+		case Vector:
+			for _, s := range v {
+				add(s.Labels, Point{T: t, V: s.V})
+			}
+		default:
+			return nil, fmt.Errorf("%w: range queries need an instant vector or scalar expression", ErrBadQuery)
+		}
+	}
+	return out, nil
+}
+
+type evaluator struct {
+	lookback int64
+	data     map[*VectorSelector][]Series
+}
+
+// prepare loads the raw samples every selector in expr needs for
+// evaluation between start and end.
+func (e *Engine) prepare(ctx context.Context, expr Expr, start, end time.Time) (*evaluator, error) {
+	ev := &evaluator{lookback: e.LookbackDelta.Milliseconds(), data: map[*VectorSelector][]Series{}}
+
+	var names, labels []string
+	var walkErr error
+	budget := e.MaxSamples
+	load := func(vs *VectorSelector, window time.Duration) {
+		if walkErr != nil {
+			return
+		}
+		metrics, ok, err := e.resolveMetrics(ctx, vs, &names)
+		if err != nil {
+			walkErr = err
+			return
+		}
+		if !ok {
+			ev.data[vs] = nil
+			return
+		}
+		matchers, err := e.resolveLabels(ctx, vs, &labels)
+		if err != nil {
+			walkErr = err
+			return
+		}
+		if budget <= 0 {
+			walkErr = fmt.Errorf("%w: query would load more than %d samples, narrow the range or selectors", ErrBadQuery, e.MaxSamples)
+			return
+		}
+
+		series, err := e.Stores.SelectSeries(ctx, store.SeriesSelect{
+			Metrics:    metrics,
+			Matchers:   matchers,
+			From:       start.Add(-window - vs.Offset),
+			To:         end.Add(-vs.Offset),
+			MaxSamples: budget,
+		})
+		if errors.Is(err, store.ErrTooManySamples) {
+			walkErr = fmt.Errorf("%w: query would load more than %d samples, narrow the range or selectors", ErrBadQuery, e.MaxSamples)
+			return
+		}
+		if err != nil {
+			walkErr = err
+			return
+		}
+
+		loaded := make([]Series, 0, len(series))
+		for _, s := range series {
+			l := promLabels(s)
+			points := make([]Point, len(s.Points))
+			for i, p := range s.Points {
+				points[i] = Point{T: p.Time.UnixMilli(), V: p.Value}
+			}
+			budget -= len(points)
+			loaded = append(loaded, Series{Labels: l, Points: points})
+		}
+		ev.data[vs] = loaded
+	}
+
+	var walk func(Expr)
+	walk = func(n Expr) {
+		switch n := n.(type) {
+		case *VectorSelector:
+			load(n, e.LookbackDelta)
+		case *MatrixSelector:
+			load(n.Vector, n.Range)
+		case *Call:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *Aggregate:
+			walk(n.Expr)
+		case *BinaryExpr:
+			walk(n.LHS)
+			walk(n.RHS)
+		case *ParenExpr:
+			walk(n.Expr)
+		}
+	}
+	walk(expr)
+	return ev, walkErr
+}
+
+// Series returns the label sets of every series matching vs.
+func (e *Engine) Series(ctx context.Context, vs *VectorSelector) ([]Labels, error) {
+	var names, labels []string
+	metrics, ok, err := e.resolveMetrics(ctx, vs, &names)
+	if err != nil || !ok {
+		return []Labels{}, err
+	}
+	matchers, err := e.resolveLabels(ctx, vs, &labels)
+	if err != nil {
+		return nil, err
+	}
+	series, err := e.Stores.FindSeries(ctx, store.SeriesSelect{Metrics: metrics, Matchers: matchers})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Labels, 0, len(series))
+	for _, s := range series {
+		out = append(out, promLabels(s))
+	}
+	return out, nil
+}
+
+// resolveMetrics maps the name matchers of vs onto stored metric names. A nil
+// slice with ok set means any metric; ok is false when nothing can match.
+// names caches the stored metric names across calls.
+func (e *Engine) resolveMetrics(ctx context.Context, vs *VectorSelector, names *[]string) ([]string, bool, error) {
+	if len(vs.NameMatchers) == 0 {
+		return nil, true, nil
+	}
+	if *names == nil {
+		all, err := e.Stores.MetricNames(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		*names = all
+	}
+	var metrics []string
+	for _, n := range *names {
+		if matchAll(vs.NameMatchers, PromName(n)) {
+			metrics = append(metrics, n)
+		}
+	}
+	return metrics, len(metrics) > 0, nil
+}
+
+// resolveLabels maps the label matchers of vs onto the stored label names
+// PromName turns into their names, so {service_name="x"} matches a stored
+// "service.name" label. labels caches the stored label names across calls.
+func (e *Engine) resolveLabels(ctx context.Context, vs *VectorSelector, labels *[]string) ([]store.LabelMatcher, error) {
+	out := make([]store.LabelMatcher, len(vs.Matchers))
+	for i, m := range vs.Matchers {
+		out[i] = m
+		if m.Name == store.NodeLabel {
+			continue
+		}
+		if *labels == nil {
+			all, err := e.Stores.LabelNames(ctx)
+			if err != nil {
+				return nil, err
+			}
+			*labels = all
+		}
+		var stored []string
+		for _, l := range *labels {
+			switch {
+			case l == m.Name:
+				// An exact match wins over rewritten names.
+				stored = append([]string{l}, stored...)
+			case l != store.NodeLabel && PromName(l) == m.Name:
+				stored = append(stored, l)
+			}
+		}
+		out[i].Stored = stored
+	}
+	return out, nil
+}
+
+func promLabels(s types.Series) Labels {
+	l := Labels{nameLabel: PromName(s.Metric)}
+	for k, v := range s.Labels {
+		n := PromName(k)
+		if _, dup := l[n]; dup && n != k {
+			// Keep the label already named n, as resolveLabels does.
+			continue
+		}
+		l[n] = v
+	}
+	return l
+}
+
+// matrixArg is the value of a range selector at one evaluation time. It only
+// exists as a function argument, or as the result of an instant query.
+type matrixArg struct {
+	series []Series
+	start  int64
+	end    int64
+}
+
+func (matrixArg) Type() string { return "matrix" }
+
+func (m matrixArg) toMatrix() Matrix {
+	out := Matrix{}
+	for _, s := range m.series {
+		if len(s.Points) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (ev *evaluator) eval(n Expr, t int64) (Value, error) {
+	switch n := n.(type) {
+	case *NumberLiteral:
+		return Scalar{T: t, V: n.Value}, nil
+	case *ParenExpr:
+		return ev.eval(n.Expr, t)
+	case *VectorSelector:
+		ref := t - n.Offset.Milliseconds()
+		out := Vector{}
+		for _, s := range ev.data[n] {
+			i := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > ref }) - 1
+			if i < 0 || s.Points[i].T <= ref-ev.lookback {
+				continue
+			}
+			out = append(out, Sample{Labels: s.Labels, Point: Point{T: t, V: s.Points[i].V}})
+		}
+		return out, nil
+	case *MatrixSelector:
+		end := t - n.Vector.Offset.Milliseconds()
+		start := end - n.Range.Milliseconds()
+		m := matrixArg{start: start, end: end}
+		for _, s := range ev.data[n.Vector] {
+			lo := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > start })
+			hi := sort.Search(len(s.Points), func(i int) bool { return s.Points[i].T > end })
+			m.series = append(m.series, Series{Labels: s.Labels, Points: s.Points[lo:hi]})
+		}
+		return m, nil
+	case *Call:
+		return functions[n.Func].eval(ev, n.Args, t)
+	case *Aggregate:
+		return ev.aggregate(n, t)
+	case *BinaryExpr:
+		return ev.binary(n, t)
+	}
+	return nil, fmt.Errorf("%w: unsupported expression %T", ErrBadQuery, n)
+}
+
+func (ev *evaluator) evalVector(n Expr, t int64) (Vector, error) {
+	v, err := ev.eval(n, t)
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := v.(Vector)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected instant vector, got %s", ErrBadQuery, v.Type())
+	}
+	return vec, nil
+}
+
+func (ev *evaluator) aggregate(n *Aggregate, t int64) (Value, error) {
+	in, err := ev.evalVector(n.Expr, t)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		labels Labels
+		values []float64
+	}
+	var order []string
+	groups := map[string]*group{}
+	for _, s := range in {
+		l := groupLabels(s.Labels, n.Grouping, n.Without)
+		key := signature(l, false)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: l}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.V)
+	}
+
+	out := make(Vector, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		var v float64
+		switch n.Op {
+		case "sum", "avg":
+			for _, x := range g.values {
+				v += x
+			}
+			if n.Op == "avg" {
+				v /= float64(len(g.values))
+			}
+		case "min":
+			v = math.Inf(1)
+			for _, x := range g.values {
+				v = math.Min(v, x)
+			}
+		case "max":
+			v = math.Inf(-1)
+			for _, x := range g.values {
+				v = math.Max(v, x)
+			}
+		case "count":
+			v = float64(len(g.values))
+		}
+		out = append(out, Sample{Labels: g.labels, Point: Point{T: t, V: v}})
+	}
+	return out, nil
+}
+
+func groupLabels(l Labels, grouping []string, without bool) Labels {
+	out := Labels{}
+	if without {
+		drop := map[string]bool{nameLabel: true}
+		for _, g := range grouping {
+			drop[g] = true
+		}
+		for k, v := range l {
+			if !drop[k] {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	for _, g := range grouping {
+		if v, ok := l[g]; ok {
+			out[g] = v
+		}
+	}
+	return out
+}
+
+func (ev *evaluator) binary(n *BinaryExpr, t int64) (Value, error) {
+	lhs, err := ev.eval(n.LHS, t)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := ev.eval(n.RHS, t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := lhs.(type) {
+	case Scalar:
+		switch r := rhs.(type) {
+		case Scalar:
+			return Scalar{T: t, V: arith(n.Op, l.V, r.V)}, nil
+		case Vector:
+			out := make(Vector, 0, len(r))
+			for _, s := range r {
+				out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: arith(n.Op, l.V, s.V)}})
+			}
+			return out, nil
+		}
+	case Vector:
+		switch r := rhs.(type) {
+		case Scalar:
+			out := make(Vector, 0, len(l))
+			for _, s := range l {
+				out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: arith(n.Op, s.V, r.V)}})
+			}
+			return out, nil
+		case Vector:
+			// One-to-one matching on the full label set, ignoring the name.
+			right := map[string]Sample{}
+			for _, s := range r {
+				right[signature(s.Labels, true)] = s
+			}
+			out := Vector{}
+			for _, s := range l {
+				if m, ok := right[signature(s.Labels, true)]; ok {
+					out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: arith(n.Op, s.V, m.V)}})
+				}
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: operator %s needs scalar or instant vector operands", ErrBadQuery, n.Op)
+}
+
+func arith(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "%":
+		return math.Mod(a, b)
+	case "^":
+		return math.Pow(a, b)
+	}
+	return math.NaN()
+}
+
+func dropName(l Labels) Labels {
+	if _, ok := l[nameLabel]; !ok {
+		return l
+	}
+	out := make(Labels, len(l))
+	for k, v := range l {
+		if k != nameLabel {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func signature(l Labels, ignoreName bool) string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		if ignoreName && k == nameLabel {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xfe)
+		b.WriteString(l[k])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// PromName maps a stored metric or label name to a valid Prometheus name.
+func PromName(name string) string {
+	out := invalidNameChars.ReplaceAllString(name, "_")
+	if out != "" && out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
+
+func matchAll(ms []store.LabelMatcher, v string) bool {
+	for _, m := range ms {
+		if !matchString(m, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchString(m store.LabelMatcher, v string) bool {
+	switch m.Op {
+	case store.MatchEqual:
+		return v == m.Value
+	case store.MatchNotEqual:
+		return v != m.Value
+	case store.MatchRegexp, store.MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(v) == (m.Op == store.MatchRegexp)
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package promql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"home-telemetry/server/internal/store"
+)
+
+func TestRangeRejectsSubMillisecondStep(t *testing.T) {
+	expr, err := Parse("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(store.Stores{})
+	start := time.Unix(1000, 0)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := e.Range(context.Background(), expr, start, start, 100*time.Microsecond)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrBadQuery) {
+			t.Fatalf("Range error = %v, want ErrBadQuery", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Range with a 100µs step did not return")
+	}
+
+	m, err := e.Range(context.Background(), expr, start, start.Add(2*time.Millisecond), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || len(m[0].Points) != 3 {
+		t.Fatalf("Range with a 1ms step = %+v, want one series of 3 points", m)
+	}
+}
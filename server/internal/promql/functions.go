@@ -0,0 +1,290 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+type argType int
+
+const (
+	argVector argType = iota
+	argMatrix
+	argScalar
+)
+
+type function struct {
+	args []argType
+	eval func(ev *evaluator, args []Expr, t int64) (Value, error)
+}
+
+func (f function) check(args []Expr) error {
+	if len(args) != len(f.args) {
+		return fmt.Errorf("expected %d arguments, got %d", len(f.args), len(args))
+	}
+	for i, a := range args {
+		_, isMatrix := unparen(a).(*MatrixSelector)
+		switch f.args[i] {
+		case argMatrix:
+			if !isMatrix {
+				return fmt.Errorf("argument %d must be a range vector such as metric[5m]", i+1)
+			}
+		default:
+			if isMatrix {
+				return errors.New("range vectors are only allowed as arguments of *_over_time, rate and similar functions")
+			}
+		}
+	}
+	return nil
+}
+
+func unparen(e Expr) Expr {
+	for {
+		p, ok := e.(*ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.Expr
+	}
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"rate":     {args: []argType{argMatrix}, eval: rangeFunc(func(m matrixArg, s Series) (float64, bool) { return extrapolatedRate(m, s, true, true) })},
+		"increase": {args: []argType{argMatrix}, eval: rangeFunc(func(m matrixArg, s Series) (float64, bool) { return extrapolatedRate(m, s, true, false) })},
+		"delta":    {args: []argType{argMatrix}, eval: rangeFunc(func(m matrixArg, s Series) (float64, bool) { return extrapolatedRate(m, s, false, false) })},
+		"irate":    {args: []argType{argMatrix}, eval: rangeFunc(instantRate)},
+		"idelta": {args: []argType{argMatrix}, eval: rangeFunc(func(_ matrixArg, s Series) (float64, bool) {
+			if len(s.Points) < 2 {
+				return 0, false
+			}
+			return s.Points[len(s.Points)-1].V - s.Points[len(s.Points)-2].V, true
+		})},
+
+		"avg_over_time": {args: []argType{argMatrix}, eval: overTime(func(ps []Point) float64 { return sum(ps) / float64(len(ps)) })},
+		"sum_over_time": {args: []argType{argMatrix}, eval: overTime(sum)},
+		"count_over_time": {args: []argType{argMatrix}, eval: overTime(func(ps []Point) float64 {
+			return float64(len(ps))
+		})},
+		"min_over_time": {args: []argType{argMatrix}, eval: overTime(func(ps []Point) float64 {
+			v := math.Inf(1)
+			for _, p := range ps {
+				v = math.Min(v, p.V)
+			}
+			return v
+		})},
+		"max_over_time": {args: []argType{argMatrix}, eval: overTime(func(ps []Point) float64 {
+			v := math.Inf(-1)
+			for _, p := range ps {
+				v = math.Max(v, p.V)
+			}
+			return v
+		})},
+		"last_over_time": {args: []argType{argMatrix}, eval: lastOverTime},
+
+		"abs":   {args: []argType{argVector}, eval: mathFunc(math.Abs)},
+		"ceil":  {args: []argType{argVector}, eval: mathFunc(math.Ceil)},
+		"floor": {args: []argType{argVector}, eval: mathFunc(math.Floor)},
+		"round": {args: []argType{argVector}, eval: mathFunc(math.Round)},
+		"clamp_min": {args: []argType{argVector, argScalar}, eval: clampFunc(func(v, bound float64) float64 {
+			return math.Max(v, bound)
+		})},
+		"clamp_max": {args: []argType{argVector, argScalar}, eval: clampFunc(func(v, bound float64) float64 {
+			return math.Min(v, bound)
+		})},
+
+		"time": {eval: func(_ *evaluator, _ []Expr, t int64) (Value, error) {
+			return Scalar{T: t, V: float64(t) / 1000}, nil
+		}},
+		"vector": {args: []argType{argScalar}, eval: func(ev *evaluator, args []Expr, t int64) (Value, error) {
+			v, err := ev.evalScalar(args[0], t)
+			if err != nil {
+				return nil, err
+			}
+			return Vector{{Labels: Labels{}, Point: Point{T: t, V: v}}}, nil
+		}},
+		"scalar": {args: []argType{argVector}, eval: func(ev *evaluator, args []Expr, t int64) (Value, error) {
+			vec, err := ev.evalVector(args[0], t)
+			if err != nil {
+				return nil, err
+			}
+			if len(vec) != 1 {
+				return Scalar{T: t, V: math.NaN()}, nil
+			}
+			return Scalar{T: t, V: vec[0].V}, nil
+		}},
+	}
+}
+
+func (ev *evaluator) evalMatrix(n Expr, t int64) (matrixArg, error) {
+	v, err := ev.eval(unparen(n), t)
+	if err != nil {
+		return matrixArg{}, err
+	}
+	return v.(matrixArg), nil
+}
+
+func (ev *evaluator) evalScalar(n Expr, t int64) (float64, error) {
+	v, err := ev.eval(n, t)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := v.(Scalar)
+	if !ok {
+		return 0, fmt.Errorf("%w: expected scalar, got %s", ErrBadQuery, v.Type())
+	}
+	return s.V, nil
+}
+
+// rangeFunc applies f to every series of a range vector argument. Series
+// for which f reports no value are left out, and the metric name is dropped.
+func rangeFunc(f func(matrixArg, Series) (float64, bool)) func(*evaluator, []Expr, int64) (Value, error) {
+	return func(ev *evaluator, args []Expr, t int64) (Value, error) {
+		m, err := ev.evalMatrix(args[0], t)
+		if err != nil {
+			return nil, err
+		}
+		out := Vector{}
+		for _, s := range m.series {
+			if v, ok := f(m, s); ok {
+				out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: v}})
+			}
+		}
+		return out, nil
+	}
+}
+
+func overTime(f func([]Point) float64) func(*evaluator, []Expr, int64) (Value, error) {
+	return rangeFunc(func(_ matrixArg, s Series) (float64, bool) {
+		if len(s.Points) == 0 {
+			return 0, false
+		}
+		return f(s.Points), true
+	})
+}
+
+func lastOverTime(ev *evaluator, args []Expr, t int64) (Value, error) {
+	m, err := ev.evalMatrix(args[0], t)
+	if err != nil {
+		return nil, err
+	}
+	out := Vector{}
+	for _, s := range m.series {
+		if len(s.Points) > 0 {
+			out = append(out, Sample{Labels: s.Labels, Point: Point{T: t, V: s.Points[len(s.Points)-1].V}})
+		}
+	}
+	return out, nil
+}
+
+func sum(ps []Point) float64 {
+	var v float64
+	for _, p := range ps {
+		v += p.V
+	}
+	return v
+}
+
+// extrapolatedRate follows Prometheus: the change between the first and last
+// sample is extrapolated towards the window edges, but by no more than half
+// an average sample interval, and counters are not extrapolated below zero.
+func extrapolatedRate(m matrixArg, s Series, isCounter, isRate bool) (float64, bool) {
+	ps := s.Points
+	if len(ps) < 2 {
+		return 0, false
+	}
+	first, last := ps[0], ps[len(ps)-1]
+
+	result := last.V - first.V
+	if isCounter {
+		prev := first.V
+		for _, p := range ps[1:] {
+			if p.V < prev {
+				result += prev
+			}
+			prev = p.V
+		}
+	}
+
+	durationToStart := float64(first.T-m.start) / 1000
+	durationToEnd := float64(m.end-last.T) / 1000
+	sampled := float64(last.T-first.T) / 1000
+	avgInterval := sampled / float64(len(ps)-1)
+
+	if isCounter && result > 0 && first.V >= 0 {
+		if toZero := sampled * (first.V / result); toZero < durationToStart {
+			durationToStart = toZero
+		}
+	}
+
+	threshold := avgInterval * 1.1
+	extrapolate := sampled
+	if durationToStart < threshold {
+		extrapolate += durationToStart
+	} else {
+		extrapolate += avgInterval / 2
+	}
+	if durationToEnd < threshold {
+		extrapolate += durationToEnd
+	} else {
+		extrapolate += avgInterval / 2
+	}
+
+	result *= extrapolate / sampled
+	if isRate {
+		result /= float64(m.end-m.start) / 1000
+	}
+	return result, true
+}
+
+func instantRate(_ matrixArg, s Series) (float64, bool) {
+	ps := s.Points
+	if len(ps) < 2 {
+		return 0, false
+	}
+	prev, last := ps[len(ps)-2], ps[len(ps)-1]
+	if last.T == prev.T {
+		return 0, false
+	}
+	diff := last.V - prev.V
+	if diff < 0 {
+		// Counter reset.
+		diff = last.V
+	}
+	return diff / (float64(last.T-prev.T) / 1000), true
+}
+
+func mathFunc(f func(float64) float64) func(*evaluator, []Expr, int64) (Value, error) {
+	return func(ev *evaluator, args []Expr, t int64) (Value, error) {
+		vec, err := ev.evalVector(args[0], t)
+		if err != nil {
+			return nil, err
+		}
+		out := make(Vector, 0, len(vec))
+		for _, s := range vec {
+			out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: f(s.V)}})
+		}
+		return out, nil
+	}
+}
+
+func clampFunc(f func(v, bound float64) float64) func(*evaluator, []Expr, int64) (Value, error) {
+	return func(ev *evaluator, args []Expr, t int64) (Value, error) {
+		vec, err := ev.evalVector(args[0], t)
+		if err != nil {
+			return nil, err
+		}
+		bound, err := ev.evalScalar(args[1], t)
+		if err != nil {
+			return nil, err
+		}
+		out := make(Vector, 0, len(vec))
+		for _, s := range vec {
+			out = append(out, Sample{Labels: dropName(s.Labels), Point: Point{T: t, V: f(s.V, bound)}})
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,192 @@
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokDuration
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokEq
+	tokNeq
+	tokRegexMatch
+	tokRegexNoMatch
+	tokAdd
+	tokSub
+	tokMul
+	tokDiv
+	tokMod
+	tokPow
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+func lex(input string) ([]token, error) {
+	var out []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+			continue
+		}
+
+		start := i
+		emit := func(kind tokenKind, n int) {
+			out = append(out, token{kind: kind, text: input[start : start+n], pos: start})
+			i += n
+		}
+
+		switch {
+		case c == '(':
+			emit(tokLParen, 1)
+		case c == ')':
+			emit(tokRParen, 1)
+		case c == '{':
+			emit(tokLBrace, 1)
+		case c == '}':
+			emit(tokRBrace, 1)
+		case c == '[':
+			emit(tokLBracket, 1)
+		case c == ']':
+			emit(tokRBracket, 1)
+		case c == ',':
+			emit(tokComma, 1)
+		case c == '+':
+			emit(tokAdd, 1)
+		case c == '-':
+			emit(tokSub, 1)
+		case c == '*':
+			emit(tokMul, 1)
+		case c == '/':
+			emit(tokDiv, 1)
+		case c == '%':
+			emit(tokMod, 1)
+		case c == '^':
+			emit(tokPow, 1)
+		case strings.HasPrefix(input[i:], "=~"):
+			emit(tokRegexMatch, 2)
+		case strings.HasPrefix(input[i:], "!~"):
+			emit(tokRegexNoMatch, 2)
+		case strings.HasPrefix(input[i:], "!="):
+			emit(tokNeq, 2)
+		case c == '=':
+			emit(tokEq, 1)
+		case c == '"' || c == '\'' || c == '`':
+			s, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", i, err)
+			}
+			out = append(out, token{kind: tokString, text: s, pos: start})
+			i += n
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			n, kind := lexNumberOrDuration(input[i:])
+			emit(kind, n)
+		case isIdentStart(rune(c)):
+			n := 1
+			for i+n < len(input) && isIdentChar(rune(input[i+n])) {
+				n++
+			}
+			emit(tokIdent, n)
+		default:
+			return nil, fmt.Errorf("at %d: unexpected character %q", i, c)
+		}
+	}
+	out = append(out, token{kind: tokEOF, pos: len(input)})
+	return out, nil
+}
+
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	if quote == '`' {
+		end := strings.IndexByte(s[1:], '`')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated raw string")
+		}
+		return s[1 : end+1], end + 2, nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			raw := s[:i+1]
+			if quote == '\'' {
+				// strconv only understands double quoted strings.
+				raw = `"` + strings.ReplaceAll(strings.ReplaceAll(raw[1:i], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			v, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// lexNumberOrDuration reads a number, or a duration such as 5m or 1h30m.
+func lexNumberOrDuration(s string) (int, tokenKind) {
+	n := 0
+	for n < len(s) && (isDigit(s[n]) || s[n] == '.') {
+		n++
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') && n+1 < len(s) && (isDigit(s[n+1]) || s[n+1] == '+' || s[n+1] == '-') {
+		n += 2
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		return n, tokNumber
+	}
+	if n < len(s) && strings.ContainsRune("smhdwy", rune(s[n])) {
+		for n < len(s) && (isDigit(s[n]) || strings.ContainsRune("smhdwy", rune(s[n]))) {
+			n++
+		}
+		return n, tokDuration
+	}
+	return n, tokNumber
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r) && r < unicode.MaxASCII
+}
+
+func isIdentChar(r rune) bool {
+	return isIdentStart(r) || r >= '0' && r <= '9'
+}
@@ -0,0 +1,490 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-telemetry/server/internal/store"
+)
+
+// Expr is a node of a parsed PromQL expression.
+type Expr interface {
+	expr()
+}
+
+// VectorSelector selects series by name and label matchers. Name matchers
+// are kept separately because metric names are mapped to stored names.
+type VectorSelector struct {
+	NameMatchers []store.LabelMatcher
+	Matchers     []store.LabelMatcher
+	Offset       time.Duration
+}
+
+type MatrixSelector struct {
+	Vector *VectorSelector
+	Range  time.Duration
+}
+
+type Call struct {
+	Func string
+	Args []Expr
+}
+
+type Aggregate struct {
+	Op       string
+	Grouping []string
+	Without  bool
+	Expr     Expr
+}
+
+type NumberLiteral struct {
+	Value float64
+}
+
+type BinaryExpr struct {
+	Op  string
+	LHS Expr
+	RHS Expr
+}
+
+type ParenExpr struct {
+	Expr Expr
+}
+
+func (*VectorSelector) expr() {}
+func (*MatrixSelector) expr() {}
+func (*Call) expr()           {}
+func (*Aggregate) expr()      {}
+func (*NumberLiteral) expr()  {}
+func (*BinaryExpr) expr()     {}
+func (*ParenExpr) expr()      {}
+
+var aggregators = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+// Parse parses the supported PromQL subset: selectors with label matchers,
+// range selectors, offset, the functions in this package, sum/avg/min/max/
+// count with by/without, and arithmetic.
+// Errors wrap ErrBadQuery.
+func Parse(input string) (Expr, error) {
+	e, err := parse(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadQuery, err)
+	}
+	return e, nil
+}
+
+func parse(input string) (Expr, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("empty query")
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return e, nil
+}
+
+// ParseSeriesSelector parses a match[] argument, which must be a plain
+// vector selector.
+func ParseSeriesSelector(input string) (*VectorSelector, error) {
+	e, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	vs, ok := e.(*VectorSelector)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a series selector", ErrBadQuery, input)
+	}
+	return vs, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at %d, got %s", what, t.pos, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	lhs, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokAdd && t.kind != tokSub {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseMul() (Expr, error) {
+	lhs, err := p.parsePow()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokMul && t.kind != tokDiv && t.kind != tokMod {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parsePow()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parsePow() (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokPow {
+		return lhs, nil
+	}
+	p.next()
+	rhs, err := p.parsePow()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: "^", LHS: lhs, RHS: rhs}, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	switch p.peek().kind {
+	case tokSub:
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := e.(*NumberLiteral); ok {
+			return &NumberLiteral{Value: -n.Value}, nil
+		}
+		return &BinaryExpr{Op: "*", LHS: &NumberLiteral{Value: -1}, RHS: e}, nil
+	case tokAdd:
+		p.next()
+		return p.parseUnary()
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (Expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokLBracket {
+		vs, ok := e.(*VectorSelector)
+		if !ok {
+			return nil, fmt.Errorf("range selector at %d must follow a series selector", p.peek().pos)
+		}
+		p.next()
+		t, err := p.expect(tokDuration, "duration")
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseDuration(t.text)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRBracket, "]"); err != nil {
+			return nil, err
+		}
+		e = &MatrixSelector{Vector: vs, Range: d}
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "offset" {
+		p.next()
+		dt, err := p.expect(tokDuration, "duration")
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseDuration(dt.text)
+		if err != nil {
+			return nil, err
+		}
+		switch sel := e.(type) {
+		case *VectorSelector:
+			sel.Offset = d
+		case *MatrixSelector:
+			sel.Vector.Offset = d
+		default:
+			return nil, fmt.Errorf("offset at %d must follow a selector", t.pos)
+		}
+	}
+	return e, nil
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return &NumberLiteral{Value: v}, nil
+	case tokLParen:
+		p.next()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return &ParenExpr{Expr: e}, nil
+	case tokLBrace:
+		return p.parseSelector("")
+	case tokIdent:
+		p.next()
+		lower := strings.ToLower(t.text)
+		switch {
+		case lower == "inf":
+			return &NumberLiteral{Value: math.Inf(1)}, nil
+		case lower == "nan":
+			return &NumberLiteral{Value: math.NaN()}, nil
+		case aggregators[t.text] && (p.peek().kind == tokLParen || isGroupingKeyword(p.peek())):
+			return p.parseAggregate(t.text)
+		case p.peek().kind == tokLParen:
+			return p.parseCall(t)
+		}
+		return p.parseSelector(t.text)
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func isGroupingKeyword(t token) bool {
+	return t.kind == tokIdent && (t.text == "by" || t.text == "without")
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unsupported function %q", name.text)
+	}
+	p.next() // (
+	var args []Expr
+	for p.peek().kind != tokRParen {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	if err := fn.check(args); err != nil {
+		return nil, fmt.Errorf("%s: %w", name.text, err)
+	}
+	return &Call{Func: name.text, Args: args}, nil
+}
+
+func (p *parser) parseAggregate(op string) (Expr, error) {
+	agg := &Aggregate{Op: op}
+	if isGroupingKeyword(p.peek()) {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	agg.Expr = e
+	if isGroupingKeyword(p.peek()) {
+		if agg.Grouping != nil {
+			return nil, fmt.Errorf("%s has two grouping clauses", op)
+		}
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+func (p *parser) parseGrouping(agg *Aggregate) error {
+	agg.Without = p.next().text == "without"
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return err
+	}
+	agg.Grouping = []string{}
+	for p.peek().kind != tokRParen {
+		t, err := p.expect(tokIdent, "label name")
+		if err != nil {
+			return err
+		}
+		agg.Grouping = append(agg.Grouping, t.text)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	_, err := p.expect(tokRParen, ")")
+	return err
+}
+
+func (p *parser) parseSelector(name string) (Expr, error) {
+	vs := &VectorSelector{}
+	if name != "" {
+		vs.NameMatchers = append(vs.NameMatchers, store.LabelMatcher{Name: nameLabel, Op: store.MatchEqual, Value: name})
+	}
+
+	if p.peek().kind == tokLBrace {
+		p.next()
+		for p.peek().kind != tokRBrace {
+			lt, err := p.expect(tokIdent, "label name")
+			if err != nil {
+				return nil, err
+			}
+			opTok := p.next()
+			var op store.MatchOp
+			switch opTok.kind {
+			case tokEq:
+				op = store.MatchEqual
+			case tokNeq:
+				op = store.MatchNotEqual
+			case tokRegexMatch:
+				op = store.MatchRegexp
+			case tokRegexNoMatch:
+				op = store.MatchNotRegexp
+			default:
+				return nil, fmt.Errorf("expected label matcher operator at %d, got %s", opTok.pos, opTok)
+			}
+			vt, err := p.expect(tokString, "label value string")
+			if err != nil {
+				return nil, err
+			}
+			m := store.LabelMatcher{Name: lt.text, Op: op, Value: vt.text}
+			if err := m.Validate(); err != nil {
+				return nil, err
+			}
+			if m.Name == nameLabel {
+				vs.NameMatchers = append(vs.NameMatchers, m)
+			} else {
+				vs.Matchers = append(vs.Matchers, m)
+			}
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokRBrace, "}"); err != nil {
+			return nil, err
+		}
+	}
+
+	if !selectsSomething(vs) {
+		return nil, fmt.Errorf("selector needs a metric name or a matcher that does not match the empty string")
+	}
+	return vs, nil
+}
+
+// selectsSomething rejects selectors like {foo=""} that would match every
+// series, as Prometheus does.
+func selectsSomething(vs *VectorSelector) bool {
+	for _, m := range append(append([]store.LabelMatcher{}, vs.NameMatchers...), vs.Matchers...) {
+		if !matchString(m, "") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDuration parses Prometheus durations such as 30s, 5m, 1h30m, 2d, 1w.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	units := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"y":  365 * 24 * time.Hour,
+	}
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		n := 0
+		for n < len(rest) && isDigit(rest[n]) {
+			n++
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		v, err := strconv.ParseInt(rest[:n], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		rest = rest[n:]
+		unit := ""
+		switch {
+		case strings.HasPrefix(rest, "ms"):
+			unit = "ms"
+		case rest != "":
+			unit = rest[:1]
+		}
+		mult, ok := units[unit]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(v) * mult
+		rest = rest[len(unit):]
+	}
+	return total, nil
+}
@@ -0,0 +1,332 @@
+// Package statsd receives StatsD (and DogStatsD tagged) metrics over UDP and
+// stores per-interval aggregates.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"home-telemetry/server/internal/store"
+	"home-telemetry/server/internal/types"
+)
+
+const maxPacket = 65535
+
+// Percentiles reported for timers.
+var Percentiles = []float64{50, 90, 95, 99}
+
+// Server aggregates received metrics and writes them every FlushInterval
+// under NodeID:
+//
+//   - counters as name.count (total for the interval, corrected for sample
+//     rate) and name.rate (per second)
+//   - gauges as name, repeated every flush with the last value; "+n"/"-n"
+//     adjust the current value
+//   - timers, histograms and distributions (ms, h, d) as name.count,
+//     name.sum, name.mean, name.min, name.max and name.pNN
+//
+// DogStatsD tags (|#key:value,flag) become labels; a tag without a value
+// gets "true". Sets and service checks are ignored.
+type Server struct {
+	NodeID        string
+	FlushInterval time.Duration
+	Stores        store.Stores
+	Logger        *log.Logger
+
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	invalid  int
+}
+
+type series struct {
+	name   string
+	labels map[string]string
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value float64
+}
+
+type timer struct {
+	series
+	values []float64
+	count  float64
+}
+
+// Listen binds the UDP socket. Call Serve to start receiving.
+func Listen(addr, nodeID string, flush time.Duration, stores store.Stores, logger *log.Logger) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		NodeID:        nodeID,
+		FlushInterval: flush,
+		Stores:        stores,
+		Logger:        logger,
+		conn:          conn,
+		counters:      map[string]*counter{},
+		gauges:        map[string]*gauge{},
+		timers:        map[string]*timer{},
+	}, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve receives packets and flushes until ctx is done, then flushes once
+// more and closes the socket.
+func (s *Server) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		_ = s.conn.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, maxPacket)
+		for {
+			n, _, err := s.conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				s.Logger.Printf("statsd read: %v", err)
+				continue
+			}
+			s.handlePacket(string(buf[:n]))
+		}
+	}()
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			<-done
+			// The request context is gone; give the last flush its own.
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			s.flush(flushCtx, time.Now())
+			cancel()
+			return
+		case now := <-ticker.C:
+			s.flush(ctx, now)
+		}
+	}
+}
+
+func (s *Server) handlePacket(packet string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := s.handleLine(line); err != nil {
+			s.invalid++
+		}
+	}
+}
+
+// handleLine parses name:value|type[|@rate][|#tags]. s.mu must be held.
+func (s *Server) handleLine(line string) error {
+	if strings.HasPrefix(line, "_sc|") || strings.HasPrefix(line, "_e{") {
+		return nil // DogStatsD service checks and events
+	}
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("missing value")
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return fmt.Errorf("missing type")
+	}
+	raw, kind := parts[0], parts[1]
+
+	rate := 1.0
+	var labels map[string]string
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			r, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return fmt.Errorf("invalid sample rate %q", p)
+			}
+			rate = r
+		case strings.HasPrefix(p, "#"):
+			labels = parseTags(p[1:])
+		}
+	}
+
+	key := seriesKey(name, labels)
+	switch kind {
+	case "c":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		c, ok := s.counters[key]
+		if !ok {
+			c = &counter{series: series{name, labels}}
+			s.counters[key] = c
+		}
+		c.value += v / rate
+	case "g":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		g, ok := s.gauges[key]
+		if !ok {
+			g = &gauge{series: series{name, labels}}
+			s.gauges[key] = g
+		}
+		if raw[0] == '+' || raw[0] == '-' {
+			g.value += v
+		} else {
+			g.value = v
+		}
+	case "ms", "h", "d":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		t, ok := s.timers[key]
+		if !ok {
+			t = &timer{series: series{name, labels}}
+			s.timers[key] = t
+		}
+		t.values = append(t.values, v)
+		t.count += 1 / rate
+	case "s":
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q", kind)
+	}
+	return nil
+}
+
+func parseTags(s string) map[string]string {
+	labels := map[string]string{}
+	for _, tag := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(tag, ":")
+		if k == "" {
+			continue
+		}
+		if !ok {
+			v = "true"
+		}
+		labels[k] = v
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+func seriesKey(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+	}
+	return b.String()
+}
+
+// flush turns the interval's aggregates into rows and stores them. Counters
+// and timers start over; gauges keep their value.
+func (s *Server) flush(ctx context.Context, now time.Time) {
+	now = now.UTC()
+	rows, invalid := s.collect(now)
+	if invalid > 0 {
+		s.Logger.Printf("statsd: ignored %d malformed lines", invalid)
+	}
+	if len(rows) == 0 {
+		return
+	}
+	if err := s.Stores.InsertIngest(ctx, s.NodeID, now, rows, nil); err != nil {
+		s.Logger.Printf("statsd flush error: %v", err)
+	}
+}
+
+func (s *Server) collect(now time.Time) ([]types.MetricRow, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rows []types.MetricRow
+	add := func(sr series, suffix string, v float64) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+		rows = append(rows, types.MetricRow{Time: now, Metric: sr.name + suffix, Value: v, Labels: sr.labels})
+	}
+
+	secs := s.FlushInterval.Seconds()
+	for _, c := range s.counters {
+		add(c.series, ".count", c.value)
+		add(c.series, ".rate", c.value/secs)
+	}
+	for _, g := range s.gauges {
+		add(g.series, "", g.value)
+	}
+	for _, t := range s.timers {
+		sort.Float64s(t.values)
+		var sum float64
+		for _, v := range t.values {
+			sum += v
+		}
+		add(t.series, ".count", t.count)
+		add(t.series, ".sum", sum)
+		add(t.series, ".mean", sum/float64(len(t.values)))
+		add(t.series, ".min", t.values[0])
+		add(t.series, ".max", t.values[len(t.values)-1])
+		for _, p := range Percentiles {
+			add(t.series, ".p"+strconv.FormatFloat(p, 'f', -1, 64), percentile(t.values, p))
+		}
+	}
+
+	invalid := s.invalid
+	s.counters = map[string]*counter{}
+	s.timers = map[string]*timer{}
+	s.invalid = 0
+	return rows, invalid
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
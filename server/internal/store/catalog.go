@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"home-telemetry/server/internal/types"
+)
+
+// SeriesSelect picks series, and optionally their raw samples, across all
+// nodes. Metrics holds exact stored metric names; empty means any metric.
+type SeriesSelect struct {
+	Metrics  []string
+	Matchers []LabelMatcher
+	From     time.Time
+	To       time.Time
+	// MaxSamples fails the select instead of loading more samples than this.
+	MaxSamples int
+}
+
+// ErrTooManySamples is returned when a select exceeds MaxSamples.
+var ErrTooManySamples = fmt.Errorf("query would load too many samples")
+
+func (sel SeriesSelect) where(args *[]any) (string, error) {
+	var clauses []string
+	if len(sel.Metrics) > 0 {
+		*args = append(*args, sel.Metrics)
+		clauses = append(clauses, fmt.Sprintf("s.metric = ANY($%d)", len(*args)))
+	}
+	for _, m := range sel.Matchers {
+		if err := m.Validate(); err != nil {
+			return "", err
+		}
+		clauses = append(clauses, m.sql(args))
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), nil
+}
+
+// MetricNames lists every stored metric name.
+func (s Stores) MetricNames(ctx context.Context) ([]string, error) {
+	return s.strings(ctx, "SELECT DISTINCT metric FROM series ORDER BY metric")
+}
+
+// LabelNames lists every label name in use, including the node label.
+func (s Stores) LabelNames(ctx context.Context) ([]string, error) {
+	names, err := s.strings(ctx, "SELECT DISTINCT jsonb_object_keys(labels) AS name FROM series ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if n == NodeLabel {
+			return names, nil
+		}
+	}
+	return append(names, NodeLabel), nil
+}
+
+// LabelValues lists the distinct values of one label.
+func (s Stores) LabelValues(ctx context.Context, name string) ([]string, error) {
+	if name == NodeLabel {
+		return s.strings(ctx, "SELECT DISTINCT node_id FROM series ORDER BY node_id")
+	}
+	return s.strings(ctx, "SELECT DISTINCT labels ->> $1::text AS value FROM series WHERE labels ? $1::text ORDER BY value", name)
+}
+
+func (s Stores) strings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// FindSeries returns the matching series without samples. The time range is
+// ignored because the catalog does not track when a series was active.
+func (s Stores) FindSeries(ctx context.Context, sel SeriesSelect) ([]types.Series, error) {
+	var args []any
+	where, err := sel.where(&args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.Pool.Query(ctx, "SELECT s.metric, "+seriesLabels+" FROM series s"+where+" ORDER BY s.metric, s.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []types.Series{}
+	for rows.Next() {
+		var series types.Series
+		var labelsBytes []byte
+		if err := rows.Scan(&series.Metric, &labelsBytes); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(labelsBytes, &series.Labels)
+		out = append(out, series)
+	}
+	return out, rows.Err()
+}
+
+// SelectSeries loads raw samples with From < time <= To for every matching
+// series, each series' points in time order.
+func (s Stores) SelectSeries(ctx context.Context, sel SeriesSelect) ([]types.Series, error) {
+	var args []any
+	where, err := sel.where(&args)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, sel.From)
+	timeClause := fmt.Sprintf("m.time > $%d", len(args))
+	args = append(args, sel.To)
+	timeClause += fmt.Sprintf(" AND m.time <= $%d", len(args))
+	if where == "" {
+		where = " WHERE " + timeClause
+	} else {
+		where += " AND " + timeClause
+	}
+
+	query := "SELECT s.id, s.metric, " + seriesLabels + ", m.time, m.value FROM metrics m JOIN series s ON s.id = m.series_id" +
+		where + " ORDER BY s.id, m.time"
+	if sel.MaxSamples > 0 {
+		args = append(args, sel.MaxSamples+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []types.Series
+	lastID := int64(-1)
+	count := 0
+	for rows.Next() {
+		var id int64
+		var metric string
+		var labelsBytes []byte
+		var p types.Point
+		if err := rows.Scan(&id, &metric, &labelsBytes, &p.Time, &p.Value); err != nil {
+			return nil, err
+		}
+		count++
+		if sel.MaxSamples > 0 && count > sel.MaxSamples {
+			return nil, ErrTooManySamples
+		}
+		if id != lastID {
+			series := types.Series{Metric: metric}
+			_ = json.Unmarshal(labelsBytes, &series.Labels)
+			out = append(out, series)
+			lastID = id
+		}
+		out[len(out)-1].Points = append(out[len(out)-1].Points, p)
+	}
+	return out, rows.Err()
+}
@@ -3,6 +3,7 @@
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -10,40 +11,100 @@ import (
 	"home-telemetry/server/internal/types"
 )
 
+var metricColumns = []string{"time", "series_id", "value"}
+
+// InsertIngest upserts the node and bulk loads its metric rows with COPY in
+// a single transaction, so a payload is either fully stored or not at all.
 func (s Stores) InsertIngest(ctx context.Context, nodeID string, ts time.Time, metrics []types.MetricRow, tags map[string]string) error {
 	metaBytes, err := encodeMap(tags)
 	if err != nil {
 		return err
 	}
 
-	batch := &pgx.Batch{}
-	batch.Queue(
-		"INSERT INTO nodes (id, name, last_seen, meta) VALUES ($1, $2, $3, $4) " +
-			"ON CONFLICT (id) DO UPDATE SET last_seen = EXCLUDED.last_seen, meta = EXCLUDED.meta",
-		nodeID, nodeID, ts, metaBytes,
-	)
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	created, err := s.insertNode(ctx, tx, nodeID, ts, metrics, metaBytes)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.series.put(created)
+	return nil
+}
+
+// InsertRows stores rows that carry their own timestamps, such as those from
+// Prometheus or Influx writers, for any number of nodes in one transaction.
+// Node meta is left as is and last_seen becomes the newest row time.
+func (s Stores) InsertRows(ctx context.Context, nodes []string, rows map[string][]types.MetricRow) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	for _, m := range metrics {
-		labelsBytes, err := encodeMap(m.Labels)
+	created := map[string]int64{}
+	for _, nodeID := range nodes {
+		metrics := rows[nodeID]
+		var last time.Time
+		for _, m := range metrics {
+			if m.Time.After(last) {
+				last = m.Time
+			}
+		}
+		if last.IsZero() {
+			last = time.Now().UTC()
+		}
+		found, err := s.insertNode(ctx, tx, nodeID, last, metrics, nil)
 		if err != nil {
-			return err
+			return fmt.Errorf("node %s: %w", nodeID, err)
 		}
-		batch.Queue(
-			"INSERT INTO metrics (time, node_id, metric, value, labels) VALUES ($1, $2, $3, $4, $5)",
-			m.Time, nodeID, m.Metric, m.Value, labelsBytes,
-		)
+		for k, id := range found {
+			created[k] = id
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.series.put(created)
+	return nil
+}
+
+// insertNode upserts the node and copies its rows within tx, returning the
+// series it created. A nil meta keeps the node's stored meta.
+func (s Stores) insertNode(ctx context.Context, tx pgx.Tx, nodeID string, ts time.Time, metrics []types.MetricRow, metaBytes []byte) (map[string]int64, error) {
+	// Replayed payloads can be older than what we already have, so last_seen
+	// only moves forward.
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO nodes (id, name, last_seen, meta) VALUES ($1, $2, $3, COALESCE($4::jsonb, '{}'::jsonb)) "+
+			"ON CONFLICT (id) DO UPDATE SET last_seen = GREATEST(nodes.last_seen, EXCLUDED.last_seen), meta = COALESCE($4::jsonb, nodes.meta)",
+		nodeID, nodeID, ts, metaBytes,
+	); err != nil {
+		return nil, err
 	}
 
-	br := s.Pool.SendBatch(ctx, batch)
-	defer br.Close()
+	if len(metrics) == 0 {
+		return nil, nil
+	}
 
-	for i := 0; i < batch.Len(); i++ {
-		if _, err := br.Exec(); err != nil {
-			return err
-		}
+	seriesIDs, created, err := s.resolveSeries(ctx, tx, nodeID, metrics)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	rows := make([][]any, len(metrics))
+	for i, m := range metrics {
+		rows[i] = []any{m.Time, seriesIDs[i], m.Value}
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"metrics"}, metricColumns, pgx.CopyFromRows(rows)); err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
 func encodeMap(m map[string]string) ([]byte, error) {
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type MatchOp string
+
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// NodeLabel is the pseudo label carrying a series' node id in queries.
+const NodeLabel = "node"
+
+// LabelMatcher selects series by one label. As in Prometheus, a missing
+// label matches as the empty string and regexps must match the whole value.
+type LabelMatcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	// Stored optionally lists the stored label names Name stands for, e.g.
+	// "service.name" for the Prometheus name "service_name". A series' value
+	// is that of the first one it carries. Empty means Name itself.
+	Stored []string
+}
+
+// ParseLabelMatcher parses "name=value", "name!=value", "name=~regex" or
+// "name!~regex".
+func ParseLabelMatcher(s string) (LabelMatcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return LabelMatcher{}, fmt.Errorf("invalid matcher %q", s)
+	}
+	m := LabelMatcher{Name: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+	for _, op := range []MatchOp{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(rest, string(op)) {
+			m.Op = op
+			m.Value = rest[len(op):]
+			break
+		}
+	}
+	if m.Op == "" {
+		return LabelMatcher{}, fmt.Errorf("invalid matcher %q", s)
+	}
+	return m, m.Validate()
+}
+
+func (m LabelMatcher) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("matcher has no label name")
+	}
+	switch m.Op {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		if _, err := regexp.Compile(anchor(m.Value)); err != nil {
+			return fmt.Errorf("matcher %s: %w", m.Name, err)
+		}
+		if _, err := pgRegexp(m.Value); err != nil {
+			return fmt.Errorf("matcher %s: %w", m.Name, err)
+		}
+	default:
+		return fmt.Errorf("matcher %s: unknown operator %q", m.Name, m.Op)
+	}
+	return nil
+}
+
+func anchor(re string) string {
+	return "^(?:" + re + ")$"
+}
+
+// pgRegexp anchors re for PostgreSQL's ~ operator. Matchers are validated
+// as Go regexps but run in PostgreSQL, whose syntax differs: a leading (?i)
+// is moved in front of the anchors, where PostgreSQL expects embedded
+// options, and constructs it does not share with Go are rejected.
+func pgRegexp(re string) (string, error) {
+	prefix := ""
+	if rest, ok := strings.CutPrefix(re, "(?i)"); ok {
+		prefix, re = "(?i)", rest
+	}
+	for i := 0; i < len(re); i++ {
+		switch re[i] {
+		case '\\':
+			if i+1 < len(re) && strings.IndexByte("zQEpPCbB", re[i+1]) >= 0 {
+				return "", fmt.Errorf("regexp escape \\%c is not supported", re[i+1])
+			}
+			i++
+		case '(':
+			if i+1 < len(re) && re[i+1] == '?' && (i+2 >= len(re) || re[i+2] != ':') {
+				return "", fmt.Errorf("regexp flags and named groups are not supported, except a leading (?i)")
+			}
+		}
+	}
+	return prefix + anchor(re), nil
+}
+
+// sql returns a condition on the series alias s, appending its parameters
+// to args. Equality uses JSONB containment so it can use the GIN index.
+func (m LabelMatcher) sql(args *[]any) string {
+	if m.Op == MatchEqual && m.Name == NodeLabel {
+		*args = append(*args, m.Value)
+		return fmt.Sprintf("s.node_id = $%d", len(*args))
+	}
+	names := m.Stored
+	if len(names) == 0 {
+		names = []string{m.Name}
+	}
+	if m.Op == MatchEqual && m.Value != "" && len(names) == 1 {
+		*args = append(*args, map[string]string{names[0]: m.Value})
+		return fmt.Sprintf("s.labels @> $%d::jsonb", len(*args))
+	}
+
+	var value string
+	if m.Name == NodeLabel {
+		value = "s.node_id"
+	} else {
+		lookups := make([]string, len(names))
+		for i, name := range names {
+			*args = append(*args, name)
+			lookups[i] = fmt.Sprintf("s.labels ->> $%d::text", len(*args))
+		}
+		value = "coalesce(" + strings.Join(lookups, ", ") + ", '')"
+	}
+	switch m.Op {
+	case MatchEqual:
+		*args = append(*args, m.Value)
+		return fmt.Sprintf("%s = $%d", value, len(*args))
+	case MatchNotEqual:
+		*args = append(*args, m.Value)
+		return fmt.Sprintf("%s <> $%d", value, len(*args))
+	case MatchRegexp:
+		re, _ := pgRegexp(m.Value)
+		*args = append(*args, re)
+		return fmt.Sprintf("%s ~ $%d", value, len(*args))
+	default:
+		re, _ := pgRegexp(m.Value)
+		*args = append(*args, re)
+		return fmt.Sprintf("%s !~ $%d", value, len(*args))
+	}
+}
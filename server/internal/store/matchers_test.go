@@ -0,0 +1,31 @@
+package store
+
+import "testing"
+
+func TestPgRegexp(t *testing.T) {
+	for re, want := range map[string]string{
+		"rtx.*":       "^(?:rtx.*)$",
+		"(?i)rtx.*":   "(?i)^(?:rtx.*)$",
+		"(?:a|b)\\d+": "^(?:(?:a|b)\\d+)$",
+		"a\\(?b":      "^(?:a\\(?b)$",
+	} {
+		got, err := pgRegexp(re)
+		if err != nil || got != want {
+			t.Errorf("pgRegexp(%q) = %q, %v; want %q", re, got, err, want)
+		}
+	}
+	for _, re := range []string{"a(?i)b", "(?s).*", "(?P<x>a)", "a\\z", "\\pL+", "\\bword\\b", "\\Q.\\E"} {
+		if got, err := pgRegexp(re); err == nil {
+			t.Errorf("pgRegexp(%q) = %q, want an error", re, got)
+		}
+	}
+}
+
+func TestParseLabelMatcherRejectsUnportableRegexp(t *testing.T) {
+	if _, err := ParseLabelMatcher("gpu=~(?i)rtx.*"); err != nil {
+		t.Errorf("leading (?i): %v", err)
+	}
+	if _, err := ParseLabelMatcher("gpu=~rtx(?i).*"); err == nil {
+		t.Error("inline flag mid-pattern: no error")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"home-telemetry/server/internal/types"
 )
@@ -34,9 +35,25 @@ func (s Stores) ListNodes(ctx context.Context) ([]Node, error) {
 	return out, nil
 }
 
-func (s Stores) QueryMetrics(ctx context.Context, q MetricsQuery) ([]types.MetricRow, error) {
-	if q.NodeID == "" {
-		return nil, fmt.Errorf("node_id required")
+// seriesLabels exposes the node id as the "node" label so results from
+// several nodes stay apart and can be grouped or matched on it.
+const seriesLabels = "s.labels || jsonb_build_object('" + NodeLabel + "', s.node_id)"
+
+// MaxBuckets and MaxBucketPoints bound bucketed queries, which are not
+// subject to the raw-row limit: the number of buckets per series and the
+// points returned across all series.
+const (
+	MaxBuckets      = 11000
+	MaxBucketPoints = 500000
+)
+
+// ErrTooManyPoints is returned when a bucketed query exceeds MaxBuckets or
+// MaxBucketPoints.
+var ErrTooManyPoints = fmt.Errorf("query would return too many points")
+
+func (s Stores) QueryMetrics(ctx context.Context, q MetricsQuery) ([]types.Series, error) {
+	if len(q.NodeIDs) == 0 && q.NodePattern == "" && q.Metric == "" {
+		return nil, fmt.Errorf("node_id, node_match or metric required")
 	}
 	limit := q.Limit
 	if limit <= 0 {
@@ -46,25 +63,106 @@ func (s Stores) QueryMetrics(ctx context.Context, q MetricsQuery) ([]types.Metri
 		limit = 10000
 	}
 
-	args := []any{q.NodeID}
-	clauses := []string{"node_id = $1"}
+	var args []any
+	var clauses []string
+
+	if len(q.NodeIDs) > 0 {
+		args = append(args, q.NodeIDs)
+		clauses = append(clauses, fmt.Sprintf("s.node_id = ANY($%d)", len(args)))
+	}
+	if q.NodePattern != "" {
+		m := LabelMatcher{Name: NodeLabel, Op: MatchRegexp, Value: q.NodePattern}
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, m.sql(&args))
+	}
 
 	if q.Metric != "" {
 		args = append(args, q.Metric)
-		clauses = append(clauses, fmt.Sprintf("metric = $%d", len(args)))
+		clauses = append(clauses, fmt.Sprintf("s.metric = $%d", len(args)))
+	}
+	for _, m := range q.Matchers {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, m.sql(&args))
 	}
 	if q.From != nil {
 		args = append(args, *q.From)
-		clauses = append(clauses, fmt.Sprintf("time >= $%d", len(args)))
+		clauses = append(clauses, fmt.Sprintf("m.time >= $%d", len(args)))
 	}
 	if q.To != nil {
 		args = append(args, *q.To)
-		clauses = append(clauses, fmt.Sprintf("time <= $%d", len(args)))
+		clauses = append(clauses, fmt.Sprintf("m.time <= $%d", len(args)))
 	}
 
-	args = append(args, limit)
-	query := "SELECT time, metric, value, labels FROM metrics WHERE " + strings.Join(clauses, " AND ") +
-		fmt.Sprintf(" ORDER BY time ASC LIMIT $%d", len(args))
+	var query string
+	maxRows := limit
+	where := " FROM metrics m JOIN series s ON s.id = m.series_id WHERE " + strings.Join(clauses, " AND ")
+	switch {
+	case q.Step > 0:
+		// Bucketed results are never cut at the raw-row limit: the range
+		// must fit MaxBuckets and the result MaxBucketPoints, or the query
+		// fails.
+		if q.From == nil {
+			return nil, fmt.Errorf("step requires from")
+		}
+		to := time.Now()
+		if q.To != nil {
+			to = *q.To
+		}
+		if buckets := to.Sub(*q.From) / q.Step; buckets > MaxBuckets {
+			return nil, fmt.Errorf("%w: %d buckets of %s, at most %d allowed", ErrTooManyPoints, buckets, q.Step, MaxBuckets)
+		}
+		maxRows = MaxBucketPoints + 1
+
+		agg := q.Agg
+		if agg == "" {
+			agg = "avg"
+		}
+		expr, ok := Aggregations[agg]
+		if !ok {
+			return nil, fmt.Errorf("unsupported agg %q", q.Agg)
+		}
+		// Grouping by the series primary key yields one point per bucket per
+		// series and lets metric and labels be selected without grouping.
+		args = append(args, q.Step)
+		bucket := fmt.Sprintf("time_bucket($%d::interval, m.time)", len(args))
+		query = "SELECT " + bucket + " AS bucket, s.metric, " + expr + " AS value, " + seriesLabels + " AS labels" + where +
+			" GROUP BY bucket, s.id"
+
+		if len(q.GroupBy) > 0 || q.GroupAgg != "" {
+			groupAgg := q.GroupAgg
+			if groupAgg == "" {
+				groupAgg = "avg"
+			}
+			combine, ok := GroupAggregations[groupAgg]
+			if !ok {
+				return nil, fmt.Errorf("unsupported group_agg %q", q.GroupAgg)
+			}
+			// No group_by labels folds every matching series into one.
+			key := "'{}'::jsonb"
+			if len(q.GroupBy) > 0 {
+				pairs := make([]string, 0, len(q.GroupBy))
+				for _, name := range q.GroupBy {
+					args = append(args, name)
+					pairs = append(pairs, fmt.Sprintf("$%d::text, labels -> $%d::text", len(args), len(args)))
+				}
+				key = "jsonb_strip_nulls(jsonb_build_object(" + strings.Join(pairs, ", ") + "))"
+			}
+			query = "SELECT bucket, metric, " + combine + ", " + key + " AS group_labels FROM (" + query + ") per_series" +
+				" GROUP BY bucket, metric, group_labels ORDER BY bucket ASC"
+		} else {
+			query += " ORDER BY bucket ASC, s.id"
+		}
+	case q.Agg != "" || len(q.GroupBy) > 0 || q.GroupAgg != "":
+		return nil, fmt.Errorf("agg, group_by and group_agg require step")
+	default:
+		query = "SELECT m.time, s.metric, m.value, " + seriesLabels + where + " ORDER BY m.time ASC"
+	}
+	args = append(args, maxRows)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
 
 	rows, err := s.Pool.Query(ctx, query, args...)
 	if err != nil {
@@ -72,20 +170,36 @@ func (s Stores) QueryMetrics(ctx context.Context, q MetricsQuery) ([]types.Metri
 	}
 	defer rows.Close()
 
-	var out []types.MetricRow
+	// Rows arrive in time order; fold them into one series per metric and
+	// label set, keeping the order in which series first appear.
+	var out []types.Series
+	index := map[string]int{}
+	points := 0
 	for rows.Next() {
-		var r types.MetricRow
+		var p types.Point
+		var metric string
 		var labelsBytes []byte
-		if err := rows.Scan(&r.Time, &r.Metric, &r.Value, &labelsBytes); err != nil {
+		if err := rows.Scan(&p.Time, &metric, &p.Value, &labelsBytes); err != nil {
 			return nil, err
 		}
-		if len(labelsBytes) > 0 {
-			_ = json.Unmarshal(labelsBytes, &r.Labels)
+		key := metric + "\x00" + string(labelsBytes)
+		i, ok := index[key]
+		if !ok {
+			series := types.Series{Metric: metric}
+			if len(labelsBytes) > 0 {
+				_ = json.Unmarshal(labelsBytes, &series.Labels)
+			}
+			i = len(out)
+			index[key] = i
+			out = append(out, series)
+		}
+		out[i].Points = append(out[i].Points, p)
+		if points++; q.Step > 0 && points > MaxBucketPoints {
+			return nil, fmt.Errorf("%w: more than %d points, narrow the range or selectors", ErrTooManyPoints, MaxBucketPoints)
 		}
-		out = append(out, r)
 	}
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
 	return out, nil
-}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+
+	"home-telemetry/server/internal/types"
+)
+
+// seriesCache maps node, metric and canonical labels to a series id. Entries
+// are only added after the transaction that created them commits.
+type seriesCache struct {
+	mu  sync.RWMutex
+	ids map[string]int64
+}
+
+func newSeriesCache() *seriesCache {
+	return &seriesCache{ids: map[string]int64{}}
+}
+
+func (c *seriesCache) get(key string) (int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	id, ok := c.ids[key]
+	return id, ok
+}
+
+func (c *seriesCache) put(found map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, id := range found {
+		c.ids[k] = id
+	}
+}
+
+// seriesKey relies on encodeMap producing sorted keys, which makes it a
+// canonical form of the label set.
+func seriesKey(nodeID, metric string, labels []byte) string {
+	return nodeID + "\x00" + metric + "\x00" + string(labels)
+}
+
+type seriesRef struct {
+	metric string
+	labels []byte
+}
+
+// resolveSeries returns the series id for every row, creating missing series
+// inside tx. The returned map holds ids not yet in the cache; pass it to
+// cache.put once tx has committed.
+func (s Stores) resolveSeries(ctx context.Context, tx pgx.Tx, nodeID string, metrics []types.MetricRow) ([]int64, map[string]int64, error) {
+	ids := make([]int64, len(metrics))
+	created := map[string]int64{}
+	var missing []seriesRef
+	missingAt := map[string][]int{}
+
+	for i, m := range metrics {
+		labels, err := encodeMap(m.Labels)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := seriesKey(nodeID, m.Metric, labels)
+		if id, ok := s.series.get(key); ok {
+			ids[i] = id
+			continue
+		}
+		if _, seen := missingAt[key]; !seen {
+			missing = append(missing, seriesRef{metric: m.Metric, labels: labels})
+		}
+		missingAt[key] = append(missingAt[key], i)
+	}
+	if len(missing) == 0 {
+		return ids, created, nil
+	}
+
+	// DO UPDATE (rather than DO NOTHING) so RETURNING yields the id of
+	// series that already exist.
+	batch := &pgx.Batch{}
+	for _, ref := range missing {
+		batch.Queue(
+			"INSERT INTO series (node_id, metric, labels) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (node_id, metric, labels) DO UPDATE SET metric = EXCLUDED.metric RETURNING id",
+			nodeID, ref.metric, ref.labels,
+		)
+	}
+	br := tx.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for _, ref := range missing {
+		var id int64
+		if err := br.QueryRow().Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		key := seriesKey(nodeID, ref.metric, ref.labels)
+		created[key] = id
+		for _, i := range missingAt[key] {
+			ids[i] = id
+		}
+	}
+	return ids, created, br.Close()
+}
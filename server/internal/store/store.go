@@ -3,9 +3,10 @@
 import "github.com/jackc/pgx/v5/pgxpool"
 
 type Stores struct {
-	Pool *pgxpool.Pool
+	Pool   *pgxpool.Pool
+	series *seriesCache
 }
 
 func New(pool *pgxpool.Pool) Stores {
-	return Stores{Pool: pool}
-}
+	return Stores{Pool: pool, series: newSeriesCache()}
+}
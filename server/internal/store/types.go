@@ -9,10 +9,45 @@ type Node struct {
 	Meta     map[string]string `json:"meta"`
 }
 
+// MetricsQuery selects series by node and metric. With no NodeIDs and no
+// NodePattern every node is included.
 type MetricsQuery struct {
-	NodeID string
-	Metric string
-	From   *time.Time
-	To     *time.Time
-	Limit  int
+	NodeIDs     []string
+	NodePattern string
+	Metric      string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+
+	// Step buckets rows with time_bucket and Agg picks how each bucket is
+	// reduced. Zero Step returns raw rows.
+	Step time.Duration
+	Agg  string
+
+	// Matchers filter series by label. GroupBy merges series that share the
+	// values of the listed labels ("node" included), combining them per
+	// bucket with GroupAgg; GroupAgg alone merges all series. Both require
+	// Step.
+	Matchers []LabelMatcher
+	GroupBy  []string
+	GroupAgg string
+}
+
+// Aggregations maps the supported agg names to their SQL over m.value.
+var Aggregations = map[string]string{
+	"avg":  "avg(m.value)",
+	"min":  "min(m.value)",
+	"max":  "max(m.value)",
+	"sum":  "sum(m.value)",
+	"last": "last(m.value, m.time)",
+	"p95":  "percentile_cont(0.95) WITHIN GROUP (ORDER BY m.value)",
+}
+
+// GroupAggregations maps the supported group_agg names to their SQL over
+// the per-series bucket values.
+var GroupAggregations = map[string]string{
+	"avg": "avg(value)",
+	"min": "min(value)",
+	"max": "max(value)",
+	"sum": "sum(value)",
 }
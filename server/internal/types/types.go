@@ -1,29 +1,85 @@
 package types
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type IngestPayload struct {
 	NodeID    string            `json:"node_id"`
 	Timestamp string            `json:"timestamp"`
 	CPU       *CPUMetrics       `json:"cpu,omitempty"`
+	Mem       *MemMetrics       `json:"mem,omitempty"`
 	GPUs      []GPUMetrics      `json:"gpus,omitempty"`
+	Samples   []Sample          `json:"samples,omitempty"`
 	Tags      map[string]string `json:"tags,omitempty"`
 }
 
+// CPUMetrics and GPUMetrics use nil for values that were not measured so
+// they are not stored as zeros.
 type CPUMetrics struct {
-	TempC    float64 `json:"temp_c,omitempty"`
-	UsagePct float64 `json:"usage_pct"`
-	LoadAvg  float64 `json:"load_avg,omitempty"`
-	FreqMHz  float64 `json:"freq_mhz,omitempty"`
-	Cores    int     `json:"cores,omitempty"`
+	TempC    *float64 `json:"temp_c,omitempty"`
+	UsagePct *float64 `json:"usage_pct,omitempty"`
+	LoadAvg  *float64 `json:"load_avg,omitempty"`
+	FreqMHz  *float64 `json:"freq_mhz,omitempty"`
+	Cores    int      `json:"cores,omitempty"`
+}
+
+// MemMetrics is physical memory and swap usage in bytes.
+type MemMetrics struct {
+	TotalBytes     *float64 `json:"total_bytes,omitempty"`
+	UsedBytes      *float64 `json:"used_bytes,omitempty"`
+	AvailableBytes *float64 `json:"available_bytes,omitempty"`
+	CachedBytes    *float64 `json:"cached_bytes,omitempty"`
+	UsedPct        *float64 `json:"used_pct,omitempty"`
+	SwapTotalBytes *float64 `json:"swap_total_bytes,omitempty"`
+	SwapUsedBytes  *float64 `json:"swap_used_bytes,omitempty"`
+	SwapUsedPct    *float64 `json:"swap_used_pct,omitempty"`
+}
+
+// Sample is a free-form measurement for sources that have no dedicated
+// struct. Metric names are dotted like the built-in ones, e.g. "disk.used_bytes".
+type Sample struct {
+	Metric string            `json:"metric"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Unit   string            `json:"unit,omitempty"`
 }
 
 type GPUMetrics struct {
-	Name      string  `json:"name"`
-	TempC    float64 `json:"temp_c,omitempty"`
-	UsagePct  float64 `json:"usage_pct"`
-	MemUsedMB float64 `json:"mem_used_mb"`
-	PowerW    float64 `json:"power_w"`
+	Name      string   `json:"name"`
+	TempC     *float64 `json:"temp_c,omitempty"`
+	UsagePct  *float64 `json:"usage_pct,omitempty"`
+	MemUsedMB *float64 `json:"mem_used_mb,omitempty"`
+	PowerW    *float64 `json:"power_w,omitempty"`
+}
+
+// BatchResult reports the outcome of every payload in a batch ingest.
+type BatchResult struct {
+	Accepted int               `json:"accepted"`
+	Failed   int               `json:"failed"`
+	Items    []BatchItemResult `json:"items"`
+}
+
+// BatchItemResult carries the HTTP status the payload would have received
+// from the single ingest endpoint.
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	NodeID string `json:"node_id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Series is the query result for one metric and label set.
+type Series struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []Point           `json:"points"`
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
 }
 
 type MetricRow struct {
@@ -37,23 +93,49 @@ func ToMetricRows(p IngestPayload, ts time.Time) []MetricRow {
 	var out []MetricRow
 
 	if p.CPU != nil {
-		out = append(out, MetricRow{Time: ts, Metric: "cpu.temp_c", Value: p.CPU.TempC})
-		out = append(out, MetricRow{Time: ts, Metric: "cpu.usage_pct", Value: p.CPU.UsagePct})
-		out = append(out, MetricRow{Time: ts, Metric: "cpu.load_avg", Value: p.CPU.LoadAvg})
-		if p.CPU.FreqMHz > 0 {
-			out = append(out, MetricRow{Time: ts, Metric: "cpu.freq_mhz", Value: p.CPU.FreqMHz})
-		}
+		out = appendMeasured(out, ts, "cpu.temp_c", p.CPU.TempC, nil)
+		out = appendMeasured(out, ts, "cpu.usage_pct", p.CPU.UsagePct, nil)
+		out = appendMeasured(out, ts, "cpu.load_avg", p.CPU.LoadAvg, nil)
+		out = appendMeasured(out, ts, "cpu.freq_mhz", p.CPU.FreqMHz, nil)
 		if p.CPU.Cores > 0 {
 			out = append(out, MetricRow{Time: ts, Metric: "cpu.cores", Value: float64(p.CPU.Cores)})
 		}
 	}
 
+	if p.Mem != nil {
+		out = appendMeasured(out, ts, "mem.total_bytes", p.Mem.TotalBytes, nil)
+		out = appendMeasured(out, ts, "mem.used_bytes", p.Mem.UsedBytes, nil)
+		out = appendMeasured(out, ts, "mem.available_bytes", p.Mem.AvailableBytes, nil)
+		out = appendMeasured(out, ts, "mem.cached_bytes", p.Mem.CachedBytes, nil)
+		out = appendMeasured(out, ts, "mem.used_pct", p.Mem.UsedPct, nil)
+		out = appendMeasured(out, ts, "mem.swap_total_bytes", p.Mem.SwapTotalBytes, nil)
+		out = appendMeasured(out, ts, "mem.swap_used_bytes", p.Mem.SwapUsedBytes, nil)
+		out = appendMeasured(out, ts, "mem.swap_used_pct", p.Mem.SwapUsedPct, nil)
+	}
+
 	for _, gpu := range p.GPUs {
 		labels := map[string]string{"gpu": gpu.Name}
-		out = append(out, MetricRow{Time: ts, Metric: "gpu.temp_c", Value: gpu.TempC, Labels: labels})
-		out = append(out, MetricRow{Time: ts, Metric: "gpu.usage_pct", Value: gpu.UsagePct, Labels: labels})
-		out = append(out, MetricRow{Time: ts, Metric: "gpu.mem_used_mb", Value: gpu.MemUsedMB, Labels: labels})
-		out = append(out, MetricRow{Time: ts, Metric: "gpu.power_w", Value: gpu.PowerW, Labels: labels})
+		out = appendMeasured(out, ts, "gpu.temp_c", gpu.TempC, labels)
+		out = appendMeasured(out, ts, "gpu.usage_pct", gpu.UsagePct, labels)
+		out = appendMeasured(out, ts, "gpu.mem_used_mb", gpu.MemUsedMB, labels)
+		out = appendMeasured(out, ts, "gpu.power_w", gpu.PowerW, labels)
+	}
+
+	for _, sample := range p.Samples {
+		if sample.Metric == "" || math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		var labels map[string]string
+		if len(sample.Labels) > 0 || sample.Unit != "" {
+			labels = make(map[string]string, len(sample.Labels)+1)
+			for k, v := range sample.Labels {
+				labels[k] = v
+			}
+			if sample.Unit != "" {
+				labels["unit"] = sample.Unit
+			}
+		}
+		out = append(out, MetricRow{Time: ts, Metric: sample.Metric, Value: sample.Value, Labels: labels})
 	}
 
 	if len(p.Tags) > 0 {
@@ -68,4 +150,12 @@ func ToMetricRows(p IngestPayload, ts time.Time) []MetricRow {
 	}
 
 	return out
-}
+}
+
+// appendMeasured adds a row for v unless it was not measured.
+func appendMeasured(out []MetricRow, ts time.Time, metric string, v *float64, labels map[string]string) []MetricRow {
+	if v == nil || math.IsNaN(*v) || math.IsInf(*v, 0) {
+		return out
+	}
+	return append(out, MetricRow{Time: ts, Metric: metric, Value: *v, Labels: labels})
+}
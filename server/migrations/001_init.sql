@@ -20,3 +20,7 @@ SELECT create_hypertable('metrics', 'time', if_not_exists => TRUE);
 
 CREATE INDEX IF NOT EXISTS metrics_node_time_idx ON metrics (node_id, time DESC);
 CREATE INDEX IF NOT EXISTS metrics_metric_time_idx ON metrics (metric, time DESC);
+
+-- +migrate Down
+DROP TABLE IF EXISTS metrics;
+DROP TABLE IF EXISTS nodes;
@@ -0,0 +1,59 @@
+-- 002_series.sql
+-- Move labels out of every metrics row into a series catalog. A series is one
+-- (node, metric, label set); JSONB equality ignores key order, so the unique
+-- constraint works on the canonical label set.
+CREATE TABLE IF NOT EXISTS series (
+  id BIGSERIAL PRIMARY KEY,
+  node_id TEXT NOT NULL REFERENCES nodes(id),
+  metric TEXT NOT NULL,
+  labels JSONB NOT NULL DEFAULT '{}'::jsonb,
+  UNIQUE (node_id, metric, labels)
+);
+
+CREATE INDEX IF NOT EXISTS series_metric_idx ON series (metric);
+CREATE INDEX IF NOT EXISTS series_labels_idx ON series USING GIN (labels);
+
+INSERT INTO series (node_id, metric, labels)
+SELECT DISTINCT node_id, metric, labels FROM metrics
+ON CONFLICT (node_id, metric, labels) DO NOTHING;
+
+CREATE TABLE metrics_v2 (
+  time TIMESTAMPTZ NOT NULL,
+  series_id BIGINT NOT NULL REFERENCES series(id),
+  value DOUBLE PRECISION NOT NULL
+);
+
+SELECT create_hypertable('metrics_v2', 'time');
+
+INSERT INTO metrics_v2 (time, series_id, value)
+SELECT m.time, s.id, m.value
+FROM metrics m
+JOIN series s ON s.node_id = m.node_id AND s.metric = m.metric AND s.labels = m.labels;
+
+DROP TABLE metrics;
+ALTER TABLE metrics_v2 RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS metrics_series_time_idx ON metrics (series_id, time DESC);
+
+-- +migrate Down
+CREATE TABLE metrics_v1 (
+  time TIMESTAMPTZ NOT NULL,
+  node_id TEXT NOT NULL REFERENCES nodes(id),
+  metric TEXT NOT NULL,
+  value DOUBLE PRECISION NOT NULL,
+  labels JSONB NOT NULL DEFAULT '{}'::jsonb
+);
+
+SELECT create_hypertable('metrics_v1', 'time');
+
+INSERT INTO metrics_v1 (time, node_id, metric, value, labels)
+SELECT m.time, s.node_id, s.metric, m.value, s.labels
+FROM metrics m
+JOIN series s ON s.id = m.series_id;
+
+DROP TABLE metrics;
+DROP TABLE series;
+ALTER TABLE metrics_v1 RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS metrics_node_time_idx ON metrics (node_id, time DESC);
+CREATE INDEX IF NOT EXISTS metrics_metric_time_idx ON metrics (metric, time DESC);
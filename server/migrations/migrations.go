@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the migrate command
+// and the server can apply them without a checkout of this directory.
+package migrations
+
+import "embed"
+
+// FS holds every NNN_name.sql file in this directory.
+//
+//go:embed *.sql
+var FS embed.FS